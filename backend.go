@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -11,6 +14,42 @@ import (
 
 type backend struct {
 	*framework.Backend
+
+	// rotationLock serializes root credential rotations and the config/auth
+	// and config/cloud writes they would otherwise race with.
+	rotationLock sync.Mutex
+
+	// staticRoleLock serializes static role writes and rotations.
+	staticRoleLock sync.Mutex
+
+	// libraryLock serializes library set writes, check-outs and check-ins.
+	libraryLock sync.Mutex
+
+	// grantLock serializes updates of the holders of role assignments.
+	grantLock sync.Mutex
+
+	// limitLock serializes updates of active lease counts and rate windows.
+	limitLock sync.Mutex
+
+	// userIDs caches the IDs of the users that access configs authenticate
+	// as, keyed by Config.identityKey.
+	userIDLock sync.RWMutex
+	userIDs    map[string]string
+
+	// clients caches authenticated identity clients, keyed by clientKey.
+	clientLock sync.RWMutex
+	clients    map[string]*cachedClient
+
+	// poolLock guards claiming pooled credentials and poolRefilling, the
+	// rolesets whose pools are being refilled.
+	poolLock      sync.Mutex
+	poolRefilling map[string]bool
+	poolRefills   sync.WaitGroup
+
+	tidyRunning    atomic.Bool
+	tidyStatusLock sync.RWMutex
+	tidyStatus     *tidyStatus
+	lastAutoTidy   time.Time
 }
 
 var _ logical.Factory = Factory
@@ -21,20 +60,57 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 		return nil, errors.New("configuration passed into backend is nil")
 	}
 
-	b := &backend{}
+	b := &backend{
+		tidyStatus: &tidyStatus{State: tidyStateInactive},
+		userIDs:    make(map[string]string),
+		clients:    make(map[string]*cachedClient),
+
+		poolRefilling: make(map[string]bool),
+	}
 	b.Backend = &framework.Backend{
 		Help:        strings.TrimSpace(openstackHelp),
 		BackendType: logical.TypeLogical,
 		Paths: []*framework.Path{
 			pathConfigAccess(b),
+			pathListConfigClouds(b),
+			pathConfigCloud(b),
 			pathConfigLease(b),
+			pathConfigRotateRoot(b),
+			pathConfigCloudRotateRoot(b),
 			pathListRoles(b),
 			pathRoles(b),
 			pathCreateCreds(b),
+			pathToken(b),
+			pathGrant(b),
+			pathListStaticRoles(b),
+			pathStaticRoles(b),
+			pathStaticCreds(b),
+			pathListLibrary(b),
+			pathLibraryManageCheckIn(b),
+			pathLibrary(b),
+			pathLibraryCheckOut(b),
+			pathLibraryCheckIn(b),
+			pathLibraryStatus(b),
+			pathTidy(b),
+			pathTidyStatus(b),
+			pathConfigAutoTidy(b),
 		},
 		Secrets: []*framework.Secret{
 			secretToken(b),
+			secretDynamicUser(b),
+			secretKeystoneToken(b),
+			secretEC2Credential(b),
+			secretTrust(b),
+			secretRoleGrant(b),
+			secretEphemeralProject(b),
+			secretLibrary(b),
 		},
+		InitializeFunc:    b.initialize,
+		Invalidate:        b.invalidate,
+		Clean:             b.clean,
+		PeriodicFunc:      b.periodicFunc,
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: walRollbackMinAge,
 	}
 
 	if err := b.Setup(ctx, conf); err != nil {
@@ -44,6 +120,46 @@ func Factory(ctx context.Context, conf *logical.BackendConfig) (logical.Backend,
 	return b, nil
 }
 
+// invalidate drops what is cached from access configs when they change on
+// another node.
+func (b *backend) invalidate(ctx context.Context, key string) {
+	if key == configAccessKey || strings.HasPrefix(key, configCloudPrefix) {
+		b.resetClients()
+		b.resetUserIDs()
+	}
+}
+
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	return errors.Join(
+		b.rotateDueRootCredentials(ctx, req.Storage),
+		b.rotateDueStaticRoles(ctx, req.Storage),
+		b.autoTidy(ctx, req.Storage),
+		b.refillPools(ctx, req.Storage),
+		b.pruneRateLimits(ctx, req.Storage),
+	)
+}
+
+// initialize starts tracking issued credentials so that tidy can tell the
+// credentials issued before apart from those that lost their lease, and
+// assigns the mount the ID it tags its credentials with.
+func (b *backend) initialize(ctx context.Context, req *logical.InitializationRequest) error {
+	if !b.WriteSafeReplicationState() {
+		return nil
+	}
+
+	_, err := b.getCredentialTracking(ctx, req.Storage)
+	return err
+}
+
+// clean waits for background pool refills before the backend is unloaded.
+func (b *backend) clean(ctx context.Context) {
+	b.poolRefills.Wait()
+}
+
 const openstackHelp = `
 The OpenStack secrets backend generates application credentials for OpenStack.
 `
@@ -2,6 +2,13 @@ package openstack
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,3 +38,401 @@ func getTestBackend(tb testing.TB) (logical.Backend, logical.Storage) {
 	}
 	return b.(*backend), config.StorageView
 }
+
+// testKeystone is a minimal Keystone v3 API that authenticates any request
+// as user123 on project123, which holds the member role and the reader role
+// it implies. Requests scoped to
+// project456 or otherproject are scoped to project456 instead.
+type testKeystone struct {
+	*httptest.Server
+
+	// authCount counts the tokens issued so far.
+	authCount atomic.Int32
+
+	// appCredCreates and appCredDeletes count application credential
+	// requests.
+	appCredCreates atomic.Int32
+	appCredDeletes atomic.Int32
+
+	// appCreds maps the IDs of the application credentials that exist to
+	// their testAppCred.
+	appCreds sync.Map
+
+	// ec2Creds maps the access keys of the EC2 credentials that exist to
+	// their projects. If loseEC2Responses is set, credentials are created
+	// but the response is lost.
+	ec2Creds         sync.Map
+	loseEC2Responses atomic.Bool
+
+	// trusts maps the IDs of the trusts that exist to their testTrust. If
+	// loseTrustResponses is set, trusts are created but the response is
+	// lost.
+	trustCreates       atomic.Int32
+	trusts             sync.Map
+	loseTrustResponses atomic.Bool
+
+	// assignments holds the role assignments that exist, keyed by
+	// "<project>/<users|groups>/<id>/<role>".
+	assignments sync.Map
+
+	// passwordUpdates counts password changes of user456.
+	passwordUpdates atomic.Int32
+
+	// password, if set, is the only password that authenticates and is
+	// changed by the user's password change requests.
+	password atomic.Pointer[string]
+}
+
+type testAppCred struct {
+	Name        string
+	Description string
+}
+
+type testTrust struct {
+	TrustorUserID string `json:"trustor_user_id"`
+	TrusteeUserID string `json:"trustee_user_id"`
+	ProjectID     string `json:"project_id"`
+	ExpiresAt     string `json:"expires_at"`
+}
+
+func newTestKeystone(tb testing.TB) *testKeystone {
+	tb.Helper()
+
+	ks := &testKeystone{}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("POST /v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Auth struct {
+				Identity struct {
+					Password struct {
+						User struct {
+							Password string `json:"password"`
+						} `json:"user"`
+					} `json:"password"`
+				} `json:"identity"`
+				Scope struct {
+					Project struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"project"`
+				} `json:"scope"`
+			} `json:"auth"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if password := ks.password.Load(); password != nil && body.Auth.Identity.Password.User.Password != *password {
+			http.Error(w, `{"error": {"code": 401}}`, http.StatusUnauthorized)
+			return
+		}
+
+		projectID, projectName := "project123", "myproject"
+		if scope := body.Auth.Scope.Project; scope.ID == "project456" || scope.Name == "otherproject" {
+			projectID, projectName = "project456", "otherproject"
+		}
+
+		n := ks.authCount.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Subject-Token", fmt.Sprintf("token-%d", n))
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": {
+			"expires_at": %q,
+			"user": {"id": "user123", "name": "svc", "domain": {"id": "default", "name": "Default"}},
+			"project": {"id": %q, "name": %q, "domain": {"id": "default", "name": "Default"}},
+			"roles": [{"id": "role-member", "name": "member"}, {"id": "role-reader", "name": "reader"}],
+			"catalog": [{"type": "identity", "name": "keystone", "endpoints": [
+				{"interface": "public", "region": "RegionOne", "region_id": "RegionOne", "url": %q}
+			]}]
+		}}`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), projectID, projectName, ks.URL+"/v3/")
+	})
+	mux.HandleFunc("DELETE /v3/auth/tokens", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	knownRoles := map[string]string{
+		"role-member": "member",
+		"role-admin":  "admin",
+		"role-reader": "reader",
+	}
+
+	mux.HandleFunc("GET /v3/role_inferences", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"role_inferences": [{
+			"prior_role": {"id": "role-member", "name": "member"},
+			"implies": [{"id": "role-reader", "name": "reader"}]
+		}]}`)
+	})
+
+	mux.HandleFunc("GET /v3/roles", func(w http.ResponseWriter, r *http.Request) {
+		var found []string
+		for id, name := range knownRoles {
+			if name == r.URL.Query().Get("name") {
+				found = append(found, fmt.Sprintf(`{"id": %q, "name": %q}`, id, name))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"roles": [%s], "links": {"next": null}}`, strings.Join(found, ","))
+	})
+
+	mux.HandleFunc("GET /v3/roles/{id}", func(w http.ResponseWriter, r *http.Request) {
+		name, ok := knownRoles[r.PathValue("id")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"role": {"id": %q, "name": %q}}`, r.PathValue("id"), name)
+	})
+
+	assignmentKey := func(r *http.Request) string {
+		return strings.Join([]string{r.PathValue("project"), r.PathValue("kind"), r.PathValue("actor"), r.PathValue("role")}, "/")
+	}
+
+	mux.HandleFunc("GET /v3/projects/{project}/{kind}/{actor}/roles", func(w http.ResponseWriter, r *http.Request) {
+		var found []string
+		for id, name := range knownRoles {
+			r.SetPathValue("role", id)
+			if _, ok := ks.assignments.Load(assignmentKey(r)); ok {
+				found = append(found, fmt.Sprintf(`{"id": %q, "name": %q}`, id, name))
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"roles": [%s], "links": {"next": null}}`, strings.Join(found, ","))
+	})
+
+	mux.HandleFunc("PUT /v3/projects/{project}/{kind}/{actor}/roles/{role}", func(w http.ResponseWriter, r *http.Request) {
+		ks.assignments.Store(assignmentKey(r), true)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("DELETE /v3/projects/{project}/{kind}/{actor}/roles/{role}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ks.assignments.LoadAndDelete(assignmentKey(r)); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /v3/users/{user}/application_credentials", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ApplicationCredential struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"application_credential"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		n := ks.appCredCreates.Add(1)
+		id := fmt.Sprintf("appcred-%d", n)
+		ks.appCreds.Store(id, testAppCred{Name: body.ApplicationCredential.Name, Description: body.ApplicationCredential.Description})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"application_credential": {"id": %q, "name": %q, "secret": "secret-%d"}}`, id, body.ApplicationCredential.Name, n)
+	})
+
+	mux.HandleFunc("GET /v3/users/{user}/application_credentials", func(w http.ResponseWriter, r *http.Request) {
+		var found []string
+		ks.appCreds.Range(func(id, value any) bool {
+			credential := value.(testAppCred)
+			if filter := r.URL.Query().Get("name"); filter == "" || filter == credential.Name {
+				found = append(found, fmt.Sprintf(`{"id": %q, "name": %q, "description": %q}`, id, credential.Name, credential.Description))
+			}
+			return true
+		})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"application_credentials": [%s], "links": {"next": null}}`, strings.Join(found, ","))
+	})
+
+	mux.HandleFunc("DELETE /v3/users/{user}/application_credentials/{id}", func(w http.ResponseWriter, r *http.Request) {
+		ks.appCredDeletes.Add(1)
+		ks.appCreds.Delete(r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /v3/projects", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"projects": [], "links": {"next": null}}`)
+	})
+
+	mux.HandleFunc("POST /v3/credentials", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Credential struct {
+				Blob      string `json:"blob"`
+				ProjectID string `json:"project_id"`
+				Type      string `json:"type"`
+				UserID    string `json:"user_id"`
+			} `json:"credential"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var blob struct {
+			Access string `json:"access"`
+		}
+		if err := json.Unmarshal([]byte(body.Credential.Blob), &blob); err != nil || body.Credential.Type != "ec2" || blob.Access == "" {
+			http.Error(w, "invalid EC2 credential", http.StatusBadRequest)
+			return
+		}
+
+		ks.ec2Creds.Store(blob.Access, body.Credential.ProjectID)
+		if ks.loseEC2Responses.Load() {
+			http.Error(w, "response lost", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"credential": {"id": "ec2-%s", "blob": %q, "project_id": %q, "type": "ec2", "user_id": %q}}`,
+			blob.Access, body.Credential.Blob, body.Credential.ProjectID, body.Credential.UserID)
+	})
+
+	mux.HandleFunc("DELETE /v3/users/{user}/credentials/OS-EC2/{access}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ks.ec2Creds.LoadAndDelete(r.PathValue("access")); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /v3/OS-TRUST/trusts", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Trust testTrust `json:"trust"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id := fmt.Sprintf("trust-%d", ks.trustCreates.Add(1))
+		ks.trusts.Store(id, body.Trust)
+		if ks.loseTrustResponses.Load() {
+			http.Error(w, "response lost", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"trust": {"id": %q, "trustor_user_id": %q, "trustee_user_id": %q, "project_id": %q, "expires_at": %q}}`,
+			id, body.Trust.TrustorUserID, body.Trust.TrusteeUserID, body.Trust.ProjectID, body.Trust.ExpiresAt)
+	})
+
+	mux.HandleFunc("GET /v3/OS-TRUST/trusts", func(w http.ResponseWriter, r *http.Request) {
+		var found []string
+		ks.trusts.Range(func(id, value any) bool {
+			trust := value.(testTrust)
+			query := r.URL.Query()
+			if query.Get("trustor_user_id") == trust.TrustorUserID && query.Get("trustee_user_id") == trust.TrusteeUserID {
+				found = append(found, fmt.Sprintf(`{"id": %q, "trustor_user_id": %q, "trustee_user_id": %q, "project_id": %q, "expires_at": %q}`,
+					id, trust.TrustorUserID, trust.TrusteeUserID, trust.ProjectID, trust.ExpiresAt))
+			}
+			return true
+		})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"trusts": [%s], "links": {"next": null}}`, strings.Join(found, ","))
+	})
+
+	mux.HandleFunc("DELETE /v3/OS-TRUST/trusts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ks.trusts.LoadAndDelete(r.PathValue("id")); !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /v3/users/{id}/password", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			User struct {
+				OriginalPassword string `json:"original_password"`
+				Password         string `json:"password"`
+			} `json:"user"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if password := ks.password.Load(); password != nil && body.User.OriginalPassword != *password {
+			http.Error(w, `{"error": {"code": 401}}`, http.StatusUnauthorized)
+			return
+		}
+		ks.password.Store(&body.User.Password)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /v3/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "user456" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"user": {"id": "user456", "name": "alice", "domain_id": "default", "enabled": true}}`)
+	})
+
+	mux.HandleFunc("PATCH /v3/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "user456" {
+			http.NotFound(w, r)
+			return
+		}
+		ks.passwordUpdates.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"user": {"id": "user456", "name": "alice", "domain_id": "default", "enabled": true}}`)
+	})
+
+	ks.Server = httptest.NewServer(mux)
+	tb.Cleanup(ks.Close)
+
+	return ks
+}
+
+// keystoneTest wraps a backend whose access config points at a test
+// Keystone.
+type keystoneTest struct {
+	t       *testing.T
+	b       logical.Backend
+	storage logical.Storage
+	ks      *testKeystone
+}
+
+func newKeystoneTest(t *testing.T) *keystoneTest {
+	t.Helper()
+
+	b, reqStorage := getTestBackend(t)
+	lt := &keystoneTest{t: t, b: b, storage: reqStorage, ks: newTestKeystone(t)}
+	lt.mustRequest(logical.UpdateOperation, configAccessKey, "", map[string]interface{}{
+		"auth_url":          lt.ks.URL + "/v3",
+		"username":          "svc",
+		"user_domain_id":    "default",
+		"password":          "secret",
+		"verify_connection": false,
+	})
+	return lt
+}
+
+func (lt *keystoneTest) request(op logical.Operation, path, entityID string, data map[string]interface{}) *logical.Response {
+	lt.t.Helper()
+
+	resp, err := lt.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Data:      data,
+		Storage:   lt.storage,
+		EntityID:  entityID,
+	})
+	if err != nil {
+		lt.t.Fatal(err)
+	}
+	return resp
+}
+
+func (lt *keystoneTest) mustRequest(op logical.Operation, path, entityID string, data map[string]interface{}) *logical.Response {
+	lt.t.Helper()
+
+	resp := lt.request(op, path, entityID, data)
+	if resp != nil && resp.IsError() {
+		lt.t.Fatal(resp.Error())
+	}
+	return resp
+}
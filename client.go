@@ -2,19 +2,151 @@ package openstack
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack"
 	"github.com/gophercloud/gophercloud/v2/openstack/config"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/hashicorp/vault/sdk/logical"
 )
 
+// clientExpiryMargin is how long before its token expires a cached client
+// is replaced, so that requests in flight don't run into the expiry.
+const clientExpiryMargin = 5 * time.Minute
+
+// cachedClient is an authenticated identity client kept across requests.
+type cachedClient struct {
+	identityClient *gophercloud.ServiceClient
+	expiresAt      time.Time
+}
+
+// cachedClient returns an identity client authenticated for cfg with the
+// roleset's scope, reusing the one from an earlier request while its token
+// is valid. Clients that hand out or revoke their own token must use client
+// instead.
+func (b *backend) cachedClient(ctx context.Context, cfg *Config, role *RoleSet) (*gophercloud.ServiceClient, error) {
+	key, err := clientKey(cfg, role)
+	if err != nil {
+		return nil, err
+	}
+
+	b.clientLock.RLock()
+	cached, ok := b.clients[key]
+	b.clientLock.RUnlock()
+	if ok && time.Until(cached.expiresAt) > clientExpiryMargin {
+		return cached.identityClient, nil
+	}
+
+	authOpts := cfg.AuthOptions(role)
+	// Reauthenticate if Keystone rejects the token before it expires, for
+	// example after it was revoked.
+	authOpts.AllowReauth = true
+
+	identityClient, err := authenticate(ctx, cfg, authOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := authResult(identityClient)
+	if err != nil {
+		return nil, err
+	}
+	token, err := result.ExtractToken()
+	if err != nil {
+		return nil, fmt.Errorf("extract token: %w", err)
+	}
+
+	b.clientLock.Lock()
+	// Clients of configs and scopes that are no longer used would otherwise
+	// pile up for the life of the backend.
+	for k, c := range b.clients {
+		if time.Until(c.expiresAt) <= clientExpiryMargin {
+			delete(b.clients, k)
+		}
+	}
+	b.clients[key] = &cachedClient{
+		identityClient: identityClient,
+		expiresAt:      token.ExpiresAt,
+	}
+	b.clientLock.Unlock()
+
+	return identityClient, nil
+}
+
+// issuedClient returns an identity client for the cloud a credential was
+// issued from. The roleset's scope is used while the roleset still lives in
+// that cloud, the cloud's default scope otherwise. Without a recorded cloud,
+// the roleset's current one is assumed. The client and config are nil if the
+// cloud is no longer configured.
+func (b *backend) issuedClient(ctx context.Context, storage logical.Storage, rolesetName string, cloud *string) (*gophercloud.ServiceClient, *Config, error) {
+	role, err := b.Role(ctx, storage, rolesetName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error retrieving roleset: %w", err)
+	}
+	switch {
+	case cloud == nil && role == nil:
+		return nil, nil, fmt.Errorf("roleset %q not found and no cloud was recorded", rolesetName)
+	case cloud != nil && (role == nil || role.Cloud != *cloud):
+		role = &RoleSet{Cloud: *cloud}
+	}
+
+	cfg, err := b.configForRole(ctx, storage, role)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return nil, nil, nil
+	}
+
+	identityClient, err := b.cachedClient(ctx, cfg, role)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	return identityClient, cfg, nil
+}
+
+// resetClients drops the cached clients after access configs have changed.
+func (b *backend) resetClients() {
+	b.clientLock.Lock()
+	b.clients = make(map[string]*cachedClient)
+	b.clientLock.Unlock()
+}
+
+// clientKey identifies the config and scope a client authenticates with.
+// The whole config is part of the key so that a rotated secret is never
+// served a client authenticated with the previous one.
+func clientKey(cfg *Config, role *RoleSet) (string, error) {
+	encoded, err := json.Marshal(struct {
+		Config *Config
+		Scope  *gophercloud.AuthScope
+	}{cfg, role.authScope(cfg)})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// client returns a newly authenticated identity client for cfg with the
+// roleset's scope.
 func client(ctx context.Context, cfg *Config, role *RoleSet) (*gophercloud.ServiceClient, error) {
-	authOpts := cfg.AuthOptions(role.ProjectID, role.ProjectName)
+	return authenticate(ctx, cfg, cfg.AuthOptions(role))
+}
 
+func authenticate(ctx context.Context, cfg *Config, authOpts *gophercloud.AuthOptions) (*gophercloud.ServiceClient, error) {
 	// Build TLS config from stored configuration
 	if (cfg.Cert != "" && cfg.Key == "") || (cfg.Cert == "" && cfg.Key != "") {
 		return nil, errors.New("either both cert and key or none must be provided")
@@ -52,3 +184,158 @@ func client(ctx context.Context, cfg *Config, role *RoleSet) (*gophercloud.Servi
 
 	return identityClient, nil
 }
+
+// authErrorMessage turns an authentication error into a message that points
+// at the likely cause.
+func authErrorMessage(err error) string {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostnameErr      x509.HostnameError
+		certErr          *tls.CertificateVerificationError
+		urlErr           *url.Error
+	)
+
+	switch {
+	case gophercloud.ResponseCodeIs(err, http.StatusUnauthorized):
+		return "the credentials were rejected by Keystone"
+	case errors.As(err, &unknownAuthority), errors.As(err, &hostnameErr), errors.As(err, &certErr):
+		return fmt.Sprintf("TLS verification failed, check cacert or insecure: %s", err)
+	case errors.As(err, &urlErr):
+		return fmt.Sprintf("the endpoint could not be reached: %s", err)
+	default:
+		return err.Error()
+	}
+}
+
+// authResult returns the token the identity client authenticated with.
+func authResult(identityClient *gophercloud.ServiceClient) (*tokens.CreateResult, error) {
+	result, ok := identityClient.ProviderClient.GetAuthResult().(tokens.CreateResult)
+	if !ok {
+		return nil, errors.New("identity client is not authenticated with a Keystone v3 token")
+	}
+	return &result, nil
+}
+
+// authenticatedUserID returns the ID of the user the identity client
+// authenticated as.
+func authenticatedUserID(identityClient *gophercloud.ServiceClient) (string, error) {
+	result, err := authResult(identityClient)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := result.ExtractUser()
+	if err != nil {
+		return "", fmt.Errorf("extract user from token: %w", err)
+	}
+	if user == nil || user.ID == "" {
+		return "", errors.New("token does not reference a user")
+	}
+
+	return user.ID, nil
+}
+
+// userID returns the ID of the user cfg authenticates as, reading it from the
+// identity client's token the first time. This works for every way of
+// authenticating, including username-only and application credential auth.
+func (b *backend) userID(cfg *Config, identityClient *gophercloud.ServiceClient) (string, error) {
+	key := cfg.identityKey()
+
+	b.userIDLock.RLock()
+	userID, ok := b.userIDs[key]
+	b.userIDLock.RUnlock()
+	if ok {
+		return userID, nil
+	}
+
+	userID, err := authenticatedUserID(identityClient)
+	if err != nil {
+		return "", err
+	}
+
+	b.userIDLock.Lock()
+	b.userIDs[key] = userID
+	b.userIDLock.Unlock()
+
+	return userID, nil
+}
+
+// resetUserIDs drops the cached user IDs after access configs have changed.
+func (b *backend) resetUserIDs() {
+	b.userIDLock.Lock()
+	b.userIDs = make(map[string]string)
+	b.userIDLock.Unlock()
+}
+
+// scopedProjectID returns the ID of the project the identity client's token
+// is scoped to.
+func scopedProjectID(identityClient *gophercloud.ServiceClient) (string, error) {
+	result, err := authResult(identityClient)
+	if err != nil {
+		return "", err
+	}
+
+	project, err := result.ExtractProject()
+	if err != nil {
+		return "", fmt.Errorf("extract project from token: %w", err)
+	}
+	if project == nil || project.ID == "" {
+		return "", errors.New("token is not scoped to a project")
+	}
+
+	return project.ID, nil
+}
+
+// resolveRoleIDs returns the IDs of the given roles, looking up the roles
+// that are only referenced by name.
+func resolveRoleIDs(ctx context.Context, identityClient *gophercloud.ServiceClient, roleRefs []applicationcredentials.Role) ([]string, error) {
+	ids := make([]string, 0, len(roleRefs))
+	for _, ref := range roleRefs {
+		if ref.ID != "" {
+			ids = append(ids, ref.ID)
+			continue
+		}
+
+		role, err := findRole(ctx, identityClient, ref)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, role.ID)
+	}
+
+	return ids, nil
+}
+
+// findRole looks up a role by ID, or by name and domain.
+func findRole(ctx context.Context, identityClient *gophercloud.ServiceClient, ref applicationcredentials.Role) (*roles.Role, error) {
+	if ref.ID != "" {
+		role, err := roles.Get(ctx, identityClient, ref.ID).Extract()
+		if gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("role %q not found", ref.ID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up role %q: %w", ref.ID, err)
+		}
+		return role, nil
+	}
+
+	pages, err := roles.List(identityClient, roles.ListOpts{
+		Name:     ref.Name,
+		DomainID: ref.DomainID,
+	}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error looking up role %q: %w", ref.Name, err)
+	}
+	found, err := roles.ExtractRoles(pages)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("role %q not found", ref.Name)
+	}
+	if len(found) != 1 {
+		return nil, fmt.Errorf("expected exactly one role named %q, found %d", ref.Name, len(found))
+	}
+
+	return &found[0], nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// cachedCredentials are credentials read from Vault along with their lease.
+type cachedCredentials struct {
+	LeaseID   string `json:"lease_id"`
+	Renewable bool   `json:"renewable"`
+
+	// LeaseDuration is the duration the lease was issued with. Renewals
+	// shrink towards the max TTL, so it is kept as originally issued.
+	LeaseDuration time.Duration     `json:"lease_duration"`
+	ExpiresAt     time.Time         `json:"expires_at"`
+	Env           map[string]string `json:"env"`
+}
+
+func newCachedCredentials(secret *api.Secret, now time.Time) (*cachedCredentials, error) {
+	rawEnv, ok := secret.Data["env"].(map[string]interface{})
+	if !ok {
+		return nil, errors.New("the response has no env field; is the roleset issuing application credentials or users?")
+	}
+
+	env := make(map[string]string, len(rawEnv))
+	for key, value := range rawEnv {
+		env[key] = fmt.Sprint(value)
+	}
+
+	leaseDuration := time.Duration(secret.LeaseDuration) * time.Second
+	return &cachedCredentials{
+		LeaseID:       secret.LeaseID,
+		Renewable:     secret.Renewable,
+		LeaseDuration: leaseDuration,
+		ExpiresAt:     now.Add(leaseDuration),
+		Env:           env,
+	}, nil
+}
+
+// fresh reports whether the credentials have more than minTTL left, or more
+// than half their lease for leases shorter than twice minTTL.
+func (c *cachedCredentials) fresh(now time.Time, minTTL time.Duration) bool {
+	threshold := minTTL
+	if half := c.LeaseDuration / 2; half < threshold {
+		threshold = half
+	}
+	return c.ExpiresAt.Sub(now) > threshold
+}
+
+// credentialCache stores the credentials of one roleset read with one Vault
+// token from one namespace of a Vault server.
+type credentialCache struct {
+	dir  string
+	name string
+}
+
+// newCredentialCache returns the cache for a roleset. The token is only
+// identified by its accessor, and only by a hash of it, so that switching
+// tokens never hands out credentials read with another token.
+func newCredentialCache(dir, address, namespace, accessor, mount, roleset string) *credentialCache {
+	sum := sha256.Sum256([]byte(strings.Join([]string{address, namespace, accessor, mount, roleset}, "\x00")))
+	return &credentialCache{
+		dir:  dir,
+		name: cacheFileName(roleset) + "-" + hex.EncodeToString(sum[:8]),
+	}
+}
+
+// cacheFileName replaces everything but letters, digits, '-' and '_' in name
+// so that it can't escape the cache directory.
+func cacheFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (c *credentialCache) path() string {
+	return filepath.Join(c.dir, c.name+".json")
+}
+
+func (c *credentialCache) cacertPath() string {
+	return filepath.Join(c.dir, c.name+"-ca.pem")
+}
+
+func (c *credentialCache) load() (*cachedCredentials, error) {
+	data, err := os.ReadFile(c.path())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &cachedCredentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %w", c.path(), err)
+	}
+	return creds, nil
+}
+
+func (c *credentialCache) save(creds *cachedCredentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	return c.write(c.path(), data)
+}
+
+func (c *credentialCache) saveCACert(cacert string) error {
+	return c.write(c.cacertPath(), []byte(cacert))
+}
+
+// write replaces a file in the cache so that concurrent readers never see a
+// partial file. Cache entries hold secrets and are only readable by the user.
+func (c *credentialCache) write(path string, data []byte) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	return nil
+}
+
+func (c *credentialCache) remove() error {
+	for _, path := range []string{c.path(), c.cacertPath()} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,257 @@
+// Command openstack-vault-helper reads OpenStack credentials from the Vault
+// OpenStack secrets engine and hands them to OpenStack clients.
+//
+// Credentials are cached locally until their lease nears expiry, at which
+// point the lease is renewed or, failing that, new credentials are read. The
+// Vault address and token are taken from the usual VAULT_* environment
+// variables and the Vault CLI token helper.
+//
+// Usage:
+//
+//	openstack-vault-helper [flags] <roleset> [command [args...]]
+//
+// Without a command, the credentials are printed as shell exports or as a
+// clouds.yaml document. With a command, it is run with the credentials in its
+// environment:
+//
+//	eval "$(openstack-vault-helper member)"
+//	openstack-vault-helper -format clouds_yaml member > clouds.yaml
+//	openstack-vault-helper member -- terraform apply
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/api/cliconfig"
+)
+
+const (
+	formatEnv        = "env"
+	formatCloudsYAML = "clouds_yaml"
+)
+
+type options struct {
+	mount    string
+	format   string
+	cloud    string
+	minTTL   time.Duration
+	cacheDir string
+	revoke   bool
+	roleset  string
+	command  []string
+}
+
+func main() {
+	if err := run(context.Background(), os.Args[1:], os.Stdout); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.ExitCode())
+		}
+		fmt.Fprintf(os.Stderr, "openstack-vault-helper: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func parseOptions(args []string) (*options, error) {
+	opts := &options{}
+
+	flags := flag.NewFlagSet("openstack-vault-helper", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: openstack-vault-helper [flags] <roleset> [command [args...]]\n\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.mount, "mount", "openstack", "Path the OpenStack secrets engine is mounted at")
+	flags.StringVar(&opts.format, "format", formatEnv, "Output format: env or clouds_yaml")
+	flags.StringVar(&opts.cloud, "cloud", "", "Name of the cloud in clouds.yaml output (default: the roleset name)")
+	flags.DurationVar(&opts.minTTL, "min-ttl", 5*time.Minute, "Renew or replace cached credentials with less time than this left")
+	flags.StringVar(&opts.cacheDir, "cache-dir", "", "Directory to cache credentials in (default: the user cache directory)")
+	flags.BoolVar(&opts.revoke, "revoke", false, "Revoke the cached credentials and remove them from the cache")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() < 1 {
+		flags.Usage()
+		return nil, errors.New("a roleset is required")
+	}
+	opts.roleset = flags.Arg(0)
+	opts.command = flags.Args()[1:]
+	if len(opts.command) > 0 && opts.command[0] == "--" {
+		opts.command = opts.command[1:]
+	}
+
+	if opts.format != formatEnv && opts.format != formatCloudsYAML {
+		return nil, fmt.Errorf("invalid format %q", opts.format)
+	}
+	if opts.cloud == "" {
+		opts.cloud = opts.roleset
+	}
+	if opts.cacheDir == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("error finding cache directory: %w", err)
+		}
+		opts.cacheDir = filepath.Join(userCacheDir, "openstack-vault-helper")
+	}
+
+	return opts, nil
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer) error {
+	opts, err := parseOptions(args)
+	if err != nil {
+		return err
+	}
+
+	client, err := vaultClient()
+	if err != nil {
+		return err
+	}
+
+	accessor, err := tokenAccessor(ctx, client)
+	if err != nil {
+		return err
+	}
+	cache := newCredentialCache(opts.cacheDir, client.Address(), client.Namespace(), accessor, opts.mount, opts.roleset)
+
+	if opts.revoke {
+		return revoke(ctx, client, cache)
+	}
+
+	creds, err := credentials(ctx, client, cache, opts)
+	if err != nil {
+		return err
+	}
+
+	if len(opts.command) > 0 {
+		cmd := exec.CommandContext(ctx, opts.command[0], opts.command[1:]...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), creds.environ()...)
+		return cmd.Run()
+	}
+
+	switch opts.format {
+	case formatCloudsYAML:
+		out, err := creds.cloudsYAML(opts.cloud)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(stdout, out)
+		return err
+	default:
+		_, err = io.WriteString(stdout, creds.exports())
+		return err
+	}
+}
+
+// vaultClient configures a client the same way the Vault CLI does, falling
+// back to the CLI's token helper when VAULT_TOKEN isn't set.
+func vaultClient() (*api.Client, error) {
+	config := api.DefaultConfig()
+	if config.Error != nil {
+		return nil, fmt.Errorf("error configuring Vault client: %w", config.Error)
+	}
+
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Vault client: %w", err)
+	}
+
+	if client.Token() == "" {
+		helper, err := cliconfig.DefaultTokenHelper()
+		if err != nil {
+			return nil, fmt.Errorf("error loading Vault token helper: %w", err)
+		}
+		token, err := helper.Get()
+		if err != nil {
+			return nil, fmt.Errorf("error reading Vault token: %w", err)
+		}
+		client.SetToken(token)
+	}
+
+	return client, nil
+}
+
+// tokenAccessor looks up the accessor of the client's token.
+func tokenAccessor(ctx context.Context, client *api.Client) (string, error) {
+	secret, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error looking up Vault token: %w", err)
+	}
+	accessor, err := secret.TokenAccessor()
+	if err != nil {
+		return "", fmt.Errorf("error looking up Vault token: %w", err)
+	}
+	return accessor, nil
+}
+
+// credentials returns the cached credentials while they are fresh, renews
+// their lease when they are about to expire and reads new ones otherwise.
+func credentials(ctx context.Context, client *api.Client, cache *credentialCache, opts *options) (*cachedCredentials, error) {
+	now := time.Now()
+
+	cached, err := cache.load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "openstack-vault-helper: ignoring cached credentials: %s\n", err)
+	}
+	if cached != nil && cached.fresh(now, opts.minTTL) {
+		return cached, nil
+	}
+
+	if cached != nil && cached.Renewable && cached.ExpiresAt.After(now) {
+		secret, err := client.Sys().RenewWithContext(ctx, cached.LeaseID, 0)
+		if err == nil && secret != nil {
+			cached.ExpiresAt = now.Add(time.Duration(secret.LeaseDuration) * time.Second)
+			if cached.fresh(now, opts.minTTL) {
+				return cached, cache.save(cached)
+			}
+		}
+	}
+
+	secret, err := client.Logical().ReadWithDataWithContext(ctx, opts.mount+"/creds/"+opts.roleset, map[string][]string{
+		"format":      {formatEnv},
+		"cacert_path": {cache.cacertPath()},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials: %w", err)
+	}
+	if secret == nil {
+		return nil, fmt.Errorf("no credentials returned for roleset %q", opts.roleset)
+	}
+
+	creds, err := newCachedCredentials(secret, now)
+	if err != nil {
+		return nil, err
+	}
+	if cacert, ok := secret.Data["cacert"].(string); ok {
+		if err := cache.saveCACert(cacert); err != nil {
+			return nil, err
+		}
+	}
+
+	return creds, cache.save(creds)
+}
+
+func revoke(ctx context.Context, client *api.Client, cache *credentialCache) error {
+	cached, err := cache.load()
+	if err != nil {
+		return err
+	}
+	if cached != nil && cached.LeaseID != "" {
+		if err := client.Sys().RevokeWithContext(ctx, cached.LeaseID); err != nil {
+			return fmt.Errorf("error revoking lease: %w", err)
+		}
+	}
+	return cache.remove()
+}
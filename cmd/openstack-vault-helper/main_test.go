@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// testVault serves creds/<roleset> and lease renewals, counting each.
+type testVault struct {
+	*httptest.Server
+
+	reads    atomic.Int32
+	renewals atomic.Int32
+
+	// renewDuration is the lease duration returned by renewals.
+	renewDuration atomic.Int32
+}
+
+func newTestVault(t *testing.T) (*testVault, *api.Client) {
+	t.Helper()
+
+	v := &testVault{}
+	v.renewDuration.Store(3600)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/openstack/creds/member", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != formatEnv {
+			http.Error(w, "unexpected format", http.StatusBadRequest)
+			return
+		}
+		n := v.reads.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{
+			"lease_id": "openstack/creds/member/lease%d",
+			"lease_duration": 3600,
+			"renewable": true,
+			"data": {
+				"env": {"OS_AUTH_URL": "https://keystone.example.com/v3", "OS_APPLICATION_CREDENTIAL_ID": "cred%d"},
+				"cacert": "-----BEGIN CERTIFICATE-----\n"
+			}
+		}`, n, n)
+	})
+	mux.HandleFunc("GET /v1/auth/token/lookup-self", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"data": {"accessor": "accessor-%s"}}`, r.Header.Get("X-Vault-Token"))
+	})
+	mux.HandleFunc("PUT /v1/sys/leases/renew", func(w http.ResponseWriter, r *http.Request) {
+		v.renewals.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"lease_id": "openstack/creds/member/lease1", "lease_duration": %d, "renewable": true}`, v.renewDuration.Load())
+	})
+	v.Server = httptest.NewServer(mux)
+	t.Cleanup(v.Close)
+
+	config := api.DefaultConfig()
+	config.Address = v.URL
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken("root")
+
+	return v, client
+}
+
+func TestCredentials_Cache(t *testing.T) {
+	t.Parallel()
+
+	vault, client := newTestVault(t)
+	opts := &options{mount: "openstack", roleset: "member", minTTL: 5 * time.Minute}
+	cache := newCredentialCache(t.TempDir(), client.Address(), "", "accessor-root", opts.mount, opts.roleset)
+
+	creds, err := credentials(context.Background(), client, cache, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Env["OS_APPLICATION_CREDENTIAL_ID"] != "cred1" {
+		t.Errorf("unexpected credentials: %v", creds.Env)
+	}
+	if _, err := os.Stat(cache.cacertPath()); err != nil {
+		t.Errorf("expected the CA certificate to be written: %s", err)
+	}
+
+	// Fresh credentials are served from the cache
+	if _, err := credentials(context.Background(), client, cache, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := vault.reads.Load(); n != 1 {
+		t.Errorf("expected 1 read, got %d", n)
+	}
+
+	// Credentials about to expire are renewed
+	creds.ExpiresAt = time.Now().Add(time.Minute)
+	if err := cache.save(creds); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := credentials(context.Background(), client, cache, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := vault.renewals.Load(); n != 1 {
+		t.Errorf("expected 1 renewal, got %d", n)
+	}
+	if n := vault.reads.Load(); n != 1 {
+		t.Errorf("expected 1 read, got %d", n)
+	}
+
+	// Leases that can't be renewed for long enough are replaced
+	vault.renewDuration.Store(60)
+	creds.ExpiresAt = time.Now().Add(time.Minute)
+	if err := cache.save(creds); err != nil {
+		t.Fatal(err)
+	}
+	creds, err = credentials(context.Background(), client, cache, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Env["OS_APPLICATION_CREDENTIAL_ID"] != "cred2" {
+		t.Errorf("expected new credentials, got %v", creds.Env)
+	}
+}
+
+func TestCredentialCache_Key(t *testing.T) {
+	t.Parallel()
+
+	_, client := newTestVault(t)
+	accessor, err := tokenAccessor(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessor != "accessor-root" {
+		t.Fatalf("unexpected accessor %q", accessor)
+	}
+
+	dir := t.TempDir()
+	base := newCredentialCache(dir, "https://vault:8200", "", accessor, "openstack", "member")
+	for name, cache := range map[string]*credentialCache{
+		"namespace": newCredentialCache(dir, "https://vault:8200", "team-a", accessor, "openstack", "member"),
+		"token":     newCredentialCache(dir, "https://vault:8200", "", "accessor-other", "openstack", "member"),
+	} {
+		if cache.path() == base.path() {
+			t.Errorf("expected a different %s to use a different cache file", name)
+		}
+	}
+
+	cache := newCredentialCache(dir, "https://vault:8200", "", accessor, "openstack", "../../etc/member")
+	if filepath.Dir(cache.path()) != dir {
+		t.Errorf("expected %s to be in %s", cache.path(), dir)
+	}
+	if strings.Contains(filepath.Base(cache.path()), accessor) {
+		t.Errorf("expected the accessor to be hashed in %s", cache.path())
+	}
+}
+
+func TestCachedCredentials_Fresh(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		creds    cachedCredentials
+		expected bool
+	}{
+		{
+			name:     "plenty left",
+			creds:    cachedCredentials{LeaseDuration: time.Hour, ExpiresAt: now.Add(30 * time.Minute)},
+			expected: true,
+		},
+		{
+			name:     "below min ttl",
+			creds:    cachedCredentials{LeaseDuration: time.Hour, ExpiresAt: now.Add(time.Minute)},
+			expected: false,
+		},
+		{
+			name:     "short lease",
+			creds:    cachedCredentials{LeaseDuration: 2 * time.Minute, ExpiresAt: now.Add(90 * time.Second)},
+			expected: true,
+		},
+		{
+			name:     "expired",
+			creds:    cachedCredentials{LeaseDuration: time.Hour, ExpiresAt: now.Add(-time.Minute)},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.creds.fresh(now, 5*time.Minute); got != tt.expected {
+				t.Errorf("fresh() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCachedCredentials_Output(t *testing.T) {
+	t.Parallel()
+
+	creds := &cachedCredentials{Env: map[string]string{
+		"OS_AUTH_URL":                      "https://keystone.example.com/v3",
+		"OS_AUTH_TYPE":                     "v3applicationcredential",
+		"OS_APPLICATION_CREDENTIAL_ID":     "cred123",
+		"OS_APPLICATION_CREDENTIAL_SECRET": "it's",
+		"OS_INSECURE":                      "true",
+	}}
+
+	exports := creds.exports()
+	if !strings.Contains(exports, `export OS_APPLICATION_CREDENTIAL_SECRET='it'\''s'`) {
+		t.Errorf("unexpected exports:\n%s", exports)
+	}
+
+	cloudsYAML, err := creds.cloudsYAML("member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"    member:\n",
+		"            application_credential_id: cred123\n",
+		"        auth_type: v3applicationcredential\n",
+		"        verify: false\n",
+	} {
+		if !strings.Contains(cloudsYAML, line) {
+			t.Errorf("expected clouds.yaml to contain %q, got:\n%s", line, cloudsYAML)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudsYAMLAuth maps the environment variables returned by the secrets
+// engine to the keys of the auth section of clouds.yaml.
+var cloudsYAMLAuth = map[string]string{
+	"OS_AUTH_URL":                      "auth_url",
+	"OS_APPLICATION_CREDENTIAL_ID":     "application_credential_id",
+	"OS_APPLICATION_CREDENTIAL_SECRET": "application_credential_secret",
+	"OS_USER_ID":                       "user_id",
+	"OS_PASSWORD":                      "password",
+	"OS_PROJECT_ID":                    "project_id",
+}
+
+// cloudsYAMLOptions maps the remaining environment variables to top-level
+// keys of a cloud in clouds.yaml.
+var cloudsYAMLOptions = map[string]string{
+	"OS_AUTH_TYPE":            "auth_type",
+	"OS_REGION_NAME":          "region_name",
+	"OS_INTERFACE":            "interface",
+	"OS_IDENTITY_API_VERSION": "identity_api_version",
+	"OS_CACERT":               "cacert",
+}
+
+func (c *cachedCredentials) sortedKeys() []string {
+	keys := make([]string, 0, len(c.Env))
+	for key := range c.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// environ returns the credentials in the form of os.Environ.
+func (c *cachedCredentials) environ() []string {
+	environ := make([]string, 0, len(c.Env))
+	for _, key := range c.sortedKeys() {
+		environ = append(environ, key+"="+c.Env[key])
+	}
+	return environ
+}
+
+// exports returns the credentials as shell export statements.
+func (c *cachedCredentials) exports() string {
+	var sb strings.Builder
+	for _, key := range c.sortedKeys() {
+		fmt.Fprintf(&sb, "export %s=%s\n", key, shellQuote(c.Env[key]))
+	}
+	return sb.String()
+}
+
+// cloudsYAML returns the credentials as a clouds.yaml document holding a
+// single cloud.
+func (c *cachedCredentials) cloudsYAML(name string) (string, error) {
+	auth := map[string]string{}
+	cloud := map[string]interface{}{"auth": auth}
+	for key, value := range c.Env {
+		if authKey, ok := cloudsYAMLAuth[key]; ok {
+			auth[authKey] = value
+		}
+		if option, ok := cloudsYAMLOptions[key]; ok {
+			cloud[option] = value
+		}
+	}
+	if c.Env["OS_INSECURE"] == "true" {
+		cloud["verify"] = false
+	}
+
+	out, err := yaml.Marshal(map[string]interface{}{
+		"clouds": map[string]interface{}{name: cloud},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding clouds.yaml: %w", err)
+	}
+	return string(out), nil
+}
+
+// shellQuote quotes a value for use in a POSIX shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
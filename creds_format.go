@@ -0,0 +1,189 @@
+package openstack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	credsFormatJSON       = "json"
+	credsFormatCloudsYAML = "clouds_yaml"
+	credsFormatOpenRC     = "openrc"
+	credsFormatEnv        = "env"
+
+	// defaultCACertPath is where clouds.yaml and openrc output expect the
+	// CA certificate to be written when the caller doesn't choose a path.
+	defaultCACertPath = "openstack-ca.pem"
+)
+
+var credsFormats = map[string]bool{
+	credsFormatJSON:       true,
+	credsFormatCloudsYAML: true,
+	credsFormatOpenRC:     true,
+	credsFormatEnv:        true,
+}
+
+// formattedCredentialTypes are the credential types that authenticate
+// against Keystone on their own and can therefore be rendered as a cloud.
+var formattedCredentialTypes = map[string]bool{
+	credentialTypeApplicationCredential: true,
+	credentialTypeDynamicUser:           true,
+	credentialTypeEphemeralProject:      true,
+}
+
+type cloudAuth struct {
+	AuthURL                     string `yaml:"auth_url"`
+	ApplicationCredentialID     string `yaml:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `yaml:"application_credential_secret,omitempty"`
+	UserID                      string `yaml:"user_id,omitempty"`
+	Password                    string `yaml:"password,omitempty"`
+	ProjectID                   string `yaml:"project_id,omitempty"`
+}
+
+type cloudEntry struct {
+	Auth               cloudAuth `yaml:"auth"`
+	AuthType           string    `yaml:"auth_type"`
+	RegionName         string    `yaml:"region_name,omitempty"`
+	Interface          string    `yaml:"interface"`
+	IdentityAPIVersion int       `yaml:"identity_api_version"`
+	CACert             string    `yaml:"cacert,omitempty"`
+	Verify             *bool     `yaml:"verify,omitempty"`
+}
+
+// cloudCredentials describes issued credentials together with the endpoint
+// they authenticate against.
+type cloudCredentials struct {
+	name       string
+	entry      cloudEntry
+	cacertPath string
+}
+
+// newCloudCredentials builds the cloud for the credentials in the response
+// data of an issued secret.
+func newCloudCredentials(name string, cfg *Config, data map[string]interface{}, cacertPath string) *cloudCredentials {
+	field := func(key string) string {
+		value, _ := data[key].(string)
+		return value
+	}
+
+	entry := cloudEntry{
+		Auth: cloudAuth{
+			AuthURL:                     cfg.AuthURL,
+			ApplicationCredentialID:     field("application_credential_id"),
+			ApplicationCredentialSecret: field("application_credential_secret"),
+			ProjectID:                   field("project_id"),
+		},
+		AuthType:           "v3applicationcredential",
+		RegionName:         cfg.RegionName,
+		Interface:          "public",
+		IdentityAPIVersion: 3,
+	}
+	if entry.Auth.ApplicationCredentialID == "" {
+		entry.AuthType = "v3password"
+		entry.Auth.UserID = field("user_id")
+		entry.Auth.Password = field("password")
+	}
+	// Application credentials are bound to their project, which Keystone
+	// refuses to have repeated in the request.
+	if entry.Auth.ApplicationCredentialID != "" {
+		entry.Auth.ProjectID = ""
+	}
+	if cfg.CACert != "" {
+		entry.CACert = cacertPath
+	}
+	if cfg.Insecure {
+		verify := false
+		entry.Verify = &verify
+	}
+
+	return &cloudCredentials{name: name, entry: entry, cacertPath: cacertPath}
+}
+
+func (c *cloudCredentials) cloudsYAML() (string, error) {
+	out, err := yaml.Marshal(map[string]interface{}{
+		"clouds": map[string]cloudEntry{c.name: c.entry},
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding clouds.yaml: %w", err)
+	}
+	return string(out), nil
+}
+
+func (c *cloudCredentials) env() map[string]string {
+	env := map[string]string{
+		"OS_AUTH_TYPE":            c.entry.AuthType,
+		"OS_AUTH_URL":             c.entry.Auth.AuthURL,
+		"OS_INTERFACE":            c.entry.Interface,
+		"OS_IDENTITY_API_VERSION": fmt.Sprint(c.entry.IdentityAPIVersion),
+	}
+	optional := map[string]string{
+		"OS_APPLICATION_CREDENTIAL_ID":     c.entry.Auth.ApplicationCredentialID,
+		"OS_APPLICATION_CREDENTIAL_SECRET": c.entry.Auth.ApplicationCredentialSecret,
+		"OS_USER_ID":                       c.entry.Auth.UserID,
+		"OS_PASSWORD":                      c.entry.Auth.Password,
+		"OS_PROJECT_ID":                    c.entry.Auth.ProjectID,
+		"OS_REGION_NAME":                   c.entry.RegionName,
+		"OS_CACERT":                        c.entry.CACert,
+	}
+	for key, value := range optional {
+		if value != "" {
+			env[key] = value
+		}
+	}
+	if c.entry.Verify != nil && !*c.entry.Verify {
+		env["OS_INSECURE"] = "true"
+	}
+	return env
+}
+
+func (c *cloudCredentials) openrc() string {
+	env := c.env()
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# OpenStack credentials for roleset %s issued by Vault\n", c.name)
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "export %s=%s\n", key, shellQuote(env[key]))
+	}
+	return sb.String()
+}
+
+// formatCredentials adds the credentials in the requested format to the
+// response data. The CA certificate is returned alongside, since both
+// clouds.yaml and openrc can only refer to it by path.
+func formatCredentials(format, name string, cfg *Config, data map[string]interface{}, cacertPath string) error {
+	if format == credsFormatJSON {
+		return nil
+	}
+
+	creds := newCloudCredentials(name, cfg, data, cacertPath)
+	switch format {
+	case credsFormatCloudsYAML:
+		out, err := creds.cloudsYAML()
+		if err != nil {
+			return err
+		}
+		data["clouds_yaml"] = out
+	case credsFormatOpenRC:
+		data["openrc"] = creds.openrc()
+	case credsFormatEnv:
+		data["env"] = creds.env()
+	}
+	if cfg.CACert != "" {
+		data["cacert"] = cfg.CACert
+		data["cacert_path"] = cacertPath
+	}
+	return nil
+}
+
+// shellQuote quotes a value for use in a POSIX shell.
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
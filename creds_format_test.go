@@ -0,0 +1,160 @@
+package openstack
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFormatCredentials(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{
+		AuthURL:    "https://keystone.example.com/v3",
+		RegionName: "RegionOne",
+		CACert:     "-----BEGIN CERTIFICATE-----\n...\n-----END CERTIFICATE-----\n",
+	}
+
+	t.Run("clouds_yaml", func(t *testing.T) {
+		t.Parallel()
+
+		data := map[string]interface{}{
+			"application_credential_id":     "cred123",
+			"application_credential_secret": "s3cret",
+		}
+		if err := formatCredentials(credsFormatCloudsYAML, "member", cfg, data, "/etc/openstack/ca.pem"); err != nil {
+			t.Fatal(err)
+		}
+
+		var clouds struct {
+			Clouds map[string]cloudEntry `yaml:"clouds"`
+		}
+		if err := yaml.Unmarshal([]byte(data["clouds_yaml"].(string)), &clouds); err != nil {
+			t.Fatal(err)
+		}
+		expected := cloudEntry{
+			Auth: cloudAuth{
+				AuthURL:                     "https://keystone.example.com/v3",
+				ApplicationCredentialID:     "cred123",
+				ApplicationCredentialSecret: "s3cret",
+			},
+			AuthType:           "v3applicationcredential",
+			RegionName:         "RegionOne",
+			Interface:          "public",
+			IdentityAPIVersion: 3,
+			CACert:             "/etc/openstack/ca.pem",
+		}
+		if !reflect.DeepEqual(clouds.Clouds["member"], expected) {
+			t.Errorf("cloud = %#v, expected %#v", clouds.Clouds["member"], expected)
+		}
+		if data["cacert"] != cfg.CACert {
+			t.Errorf("expected the CA certificate to be returned, got %v", data["cacert"])
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Parallel()
+
+		data := map[string]interface{}{
+			"user_id":    "user123",
+			"password":   "s3cret",
+			"project_id": "project123",
+		}
+		if err := formatCredentials(credsFormatEnv, "member", &Config{AuthURL: cfg.AuthURL, Insecure: true}, data, defaultCACertPath); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[string]string{
+			"OS_AUTH_TYPE":            "v3password",
+			"OS_AUTH_URL":             "https://keystone.example.com/v3",
+			"OS_INTERFACE":            "public",
+			"OS_IDENTITY_API_VERSION": "3",
+			"OS_USER_ID":              "user123",
+			"OS_PASSWORD":             "s3cret",
+			"OS_PROJECT_ID":           "project123",
+			"OS_INSECURE":             "true",
+		}
+		if !reflect.DeepEqual(data["env"], expected) {
+			t.Errorf("env = %#v, expected %#v", data["env"], expected)
+		}
+		if _, ok := data["cacert"]; ok {
+			t.Error("expected no CA certificate without cacert configured")
+		}
+	})
+
+	t.Run("openrc", func(t *testing.T) {
+		t.Parallel()
+
+		data := map[string]interface{}{
+			"application_credential_id":     "cred123",
+			"application_credential_secret": "it's",
+		}
+		if err := formatCredentials(credsFormatOpenRC, "member", cfg, data, defaultCACertPath); err != nil {
+			t.Fatal(err)
+		}
+
+		openrc := data["openrc"].(string)
+		for _, line := range []string{
+			"export OS_APPLICATION_CREDENTIAL_ID='cred123'\n",
+			`export OS_APPLICATION_CREDENTIAL_SECRET='it'\''s'` + "\n",
+			"export OS_CACERT='openstack-ca.pem'\n",
+			"export OS_REGION_NAME='RegionOne'\n",
+		} {
+			if !strings.Contains(openrc, line) {
+				t.Errorf("expected openrc to contain %q, got:\n%s", line, openrc)
+			}
+		}
+	})
+}
+
+func TestCreds_FormatValidation(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	for path, data := range map[string]map[string]interface{}{
+		configAccessKey: {
+			"auth_url":          "https://keystone.example.com/v3",
+			"user_id":           "user123",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		"roleset/ec2": {
+			"project_id":        "project123",
+			"credential_type":   credentialTypeEC2,
+			"verify_connection": false,
+		},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatal(resp.Error())
+		}
+	}
+
+	for _, format := range []string{"yaml", credsFormatOpenRC} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "creds/ec2",
+			Data:      map[string]interface{}{"format": format},
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Errorf("expected error response for format %q, got %#v", format, resp)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package openstack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	leaseCountPrefix = "lease-count/"
+	rateLimitPrefix  = "rate-limit/"
+
+	defaultRateLimitPeriod = time.Minute
+
+	// leaseCountedKey marks leases that were added to their roleset's
+	// active lease count and must be taken off it when revoked.
+	leaseCountedKey = "lease_counted"
+
+	// leaseCountInstanceKey records which instance of the roleset a lease
+	// was counted against, so that leases outliving a deleted roleset are
+	// never taken off the count of a new roleset with the same name.
+	leaseCountInstanceKey = "lease_count_instance"
+)
+
+// leaseCount is the number of unrevoked leases issued from a roleset.
+type leaseCount struct {
+	Active int `json:"active"`
+}
+
+// rateWindow counts the credentials an entity read from a roleset between
+// Start and End.
+type rateWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Count int       `json:"count"`
+}
+
+func (r *RoleSet) rateLimitPeriod() time.Duration {
+	if r.RateLimitPeriod > 0 {
+		return r.RateLimitPeriod
+	}
+	return defaultRateLimitPeriod
+}
+
+// requesterID identifies the caller of a request, by entity where there is
+// one and by token otherwise.
+func requesterID(req *logical.Request) string {
+	if req.EntityID != "" {
+		return req.EntityID
+	}
+	return req.ClientTokenAccessor
+}
+
+// leaseCountKey returns the storage key of the active lease count of an
+// instance of the roleset. Rolesets created before instances were tracked
+// have no instance ID and keep their count under the roleset's name.
+func leaseCountKey(name, instanceID string) string {
+	if instanceID == "" {
+		return leaseCountPrefix + name
+	}
+	return leaseCountPrefix + name + "/" + instanceID
+}
+
+// rateLimitKey returns the storage key of the requester's rate window for
+// the roleset. The requester is hashed so that any ID makes a valid key.
+func rateLimitKey(name string, req *logical.Request) string {
+	sum := sha256.Sum256([]byte(requesterID(req)))
+	return rateLimitPrefix + name + "/" + hex.EncodeToString(sum[:])
+}
+
+// reserveLease enforces the roleset's rate limit and active lease cap and
+// counts the lease about to be issued. It returns an error response if a
+// limit is exceeded. Reserved leases must be cancelled if issuance fails.
+func (b *backend) reserveLease(ctx context.Context, req *logical.Request, name string, role *RoleSet) (*logical.Response, error) {
+	b.limitLock.Lock()
+	defer b.limitLock.Unlock()
+
+	countKey := leaseCountKey(name, role.InstanceID)
+	count, err := getLeaseCount(ctx, req.Storage, countKey)
+	if err != nil {
+		return nil, err
+	}
+	if role.MaxActiveLeases > 0 && count.Active >= role.MaxActiveLeases {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"roleset %q has reached its limit of %d active leases; revoke unused leases or raise max_active_leases",
+			name, role.MaxActiveLeases,
+		)), nil
+	}
+
+	if role.RateLimit > 0 {
+		key := rateLimitKey(name, req)
+		window := &rateWindow{}
+		entry, err := req.Storage.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			if err := entry.DecodeJSON(window); err != nil {
+				return nil, err
+			}
+		}
+
+		now := time.Now()
+		if !now.Before(window.End) {
+			window = &rateWindow{Start: now, End: now.Add(role.rateLimitPeriod())}
+		}
+		if window.Count >= role.RateLimit {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"rate limit of %d credentials per %s exceeded for roleset %q; retry in %s",
+				role.RateLimit, role.rateLimitPeriod(), name, time.Until(window.End).Round(time.Second),
+			)), nil
+		}
+
+		window.Count++
+		entry, err = logical.StorageEntryJSON(key, window)
+		if err != nil {
+			return nil, err
+		}
+		if err := req.Storage.Put(ctx, entry); err != nil {
+			return nil, err
+		}
+	}
+
+	count.Active++
+	return nil, putLeaseCount(ctx, req.Storage, countKey, count)
+}
+
+// releaseLease takes a lease off the active lease count stored under
+// countKey. Counts that are gone, because their roleset was deleted, are
+// left alone.
+func (b *backend) releaseLease(ctx context.Context, storage logical.Storage, countKey string) error {
+	b.limitLock.Lock()
+	defer b.limitLock.Unlock()
+
+	count, err := getLeaseCount(ctx, storage, countKey)
+	if err != nil {
+		return err
+	}
+	if count.Active == 0 {
+		return nil
+	}
+
+	count.Active--
+	if count.Active == 0 {
+		return storage.Delete(ctx, countKey)
+	}
+	return putLeaseCount(ctx, storage, countKey, count)
+}
+
+// cancelLease undoes the reservation of a lease that failed to be issued,
+// taking it off the active lease count and handing its slot in the rate
+// window back to the requester.
+func (b *backend) cancelLease(ctx context.Context, req *logical.Request, name string, role *RoleSet) error {
+	if err := b.releaseLease(ctx, req.Storage, leaseCountKey(name, role.InstanceID)); err != nil {
+		return err
+	}
+
+	b.limitLock.Lock()
+	defer b.limitLock.Unlock()
+
+	key := rateLimitKey(name, req)
+	entry, err := req.Storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	window := &rateWindow{}
+	if err := entry.DecodeJSON(window); err != nil {
+		return err
+	}
+	// A window that has ended no longer limits anything.
+	if window.Count == 0 || !time.Now().Before(window.End) {
+		return nil
+	}
+
+	window.Count--
+	entry, err = logical.StorageEntryJSON(key, window)
+	if err != nil {
+		return err
+	}
+	return req.Storage.Put(ctx, entry)
+}
+
+// issueCountedLease reserves a lease on the roleset and issues it. The
+// reservation is cancelled if issuance fails; otherwise the lease is marked
+// so that revoking it releases the reservation.
+func (b *backend) issueCountedLease(ctx context.Context, req *logical.Request, name string, role *RoleSet, issue func() (*logical.Response, error)) (*logical.Response, error) {
+	if resp, err := b.reserveLease(ctx, req, name, role); err != nil || resp != nil {
+		return resp, err
+	}
+
+	resp, err := issue()
+	if err != nil || resp == nil || resp.IsError() || resp.Secret == nil {
+		if cancelErr := b.cancelLease(ctx, req, name, role); cancelErr != nil {
+			b.Logger().Warn("failed to update active lease count", "roleset", name, "error", cancelErr)
+		}
+		return resp, err
+	}
+	resp.Secret.InternalData[leaseCountedKey] = true
+	resp.Secret.InternalData[leaseCountInstanceKey] = role.InstanceID
+	return resp, nil
+}
+
+// releasingLease wraps a revoke function so that counted leases are taken
+// off their roleset's active lease count once they have been revoked.
+func (b *backend) releasingLease(revoke framework.OperationFunc) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		resp, err := revoke(ctx, req, d)
+		if err != nil || (resp != nil && resp.IsError()) {
+			return resp, err
+		}
+
+		if counted, _ := req.Secret.InternalData[leaseCountedKey].(bool); !counted {
+			return resp, nil
+		}
+		name, err := leaseInternalString(req, "roleset")
+		if err != nil {
+			return nil, err
+		}
+		instanceID, _ := req.Secret.InternalData[leaseCountInstanceKey].(string)
+		if err := b.releaseLease(ctx, req.Storage, leaseCountKey(name, instanceID)); err != nil {
+			return nil, fmt.Errorf("error updating active lease count: %w", err)
+		}
+		return resp, nil
+	}
+}
+
+// pruneRateLimits deletes rate windows that have ended.
+func (b *backend) pruneRateLimits(ctx context.Context, storage logical.Storage) error {
+	b.limitLock.Lock()
+	defer b.limitLock.Unlock()
+
+	rolesets, err := storage.List(ctx, rateLimitPrefix)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var errs error
+	for _, roleset := range rolesets {
+		prefix := rateLimitPrefix + strings.TrimSuffix(roleset, "/") + "/"
+		keys, err := storage.List(ctx, prefix)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		for _, key := range keys {
+			entry, err := storage.Get(ctx, prefix+key)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if entry == nil {
+				continue
+			}
+
+			window := &rateWindow{}
+			if err := entry.DecodeJSON(window); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if now.Before(window.End) {
+				continue
+			}
+			if err := storage.Delete(ctx, prefix+key); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+	return errs
+}
+
+// deleteRoleSetLimits drops the active lease count and rate windows of a
+// deleted roleset, so that a roleset created with the same name starts
+// afresh.
+func (b *backend) deleteRoleSetLimits(ctx context.Context, storage logical.Storage, name string, role *RoleSet) error {
+	b.limitLock.Lock()
+	defer b.limitLock.Unlock()
+
+	if err := storage.Delete(ctx, leaseCountKey(name, role.InstanceID)); err != nil {
+		return err
+	}
+
+	prefix := rateLimitPrefix + name + "/"
+	keys, err := storage.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := storage.Delete(ctx, prefix+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getLeaseCount(ctx context.Context, storage logical.Storage, key string) (*leaseCount, error) {
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving active lease count: %w", err)
+	}
+
+	count := &leaseCount{}
+	if entry != nil {
+		if err := entry.DecodeJSON(count); err != nil {
+			return nil, err
+		}
+	}
+	return count, nil
+}
+
+func putLeaseCount(ctx context.Context, storage logical.Storage, key string, count *leaseCount) error {
+	entry, err := logical.StorageEntryJSON(key, count)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
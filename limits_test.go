@@ -0,0 +1,233 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func newLimitsTest(t *testing.T, roleset map[string]interface{}) *keystoneTest {
+	t.Helper()
+
+	lt := newKeystoneTest(t)
+	roleset["project_id"] = "project123"
+	roleset["roles"] = "member"
+	roleset["verify_connection"] = false
+	lt.mustRequest(logical.UpdateOperation, "roleset/member", "", roleset)
+	return lt
+}
+
+// activeLeases returns the active lease count of the roleset.
+func activeLeases(t *testing.T, lt *keystoneTest, name string) int {
+	t.Helper()
+
+	role, err := lt.b.(*backend).Role(context.Background(), lt.storage, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := getLeaseCount(context.Background(), lt.storage, leaseCountKey(name, role.InstanceID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count.Active
+}
+
+func TestLimits_MaxActiveLeases(t *testing.T) {
+	t.Parallel()
+
+	lt := newLimitsTest(t, map[string]interface{}{"max_active_leases": 2})
+
+	first := lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+	lt.mustRequest(logical.ReadOperation, "creds/member", "bob", nil)
+
+	resp := lt.request(logical.ReadOperation, "creds/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the active lease limit to be enforced")
+	}
+
+	// Revoking a lease makes room for another
+	if _, err := lt.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   lt.storage,
+		Secret:    first.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n := activeLeases(t, lt, "member"); n != 1 {
+		t.Errorf("expected 1 active lease, got %d", n)
+	}
+	lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+
+	// Leases are counted even if no limit is set yet
+	lt.mustRequest(logical.UpdateOperation, "roleset/member", "", map[string]interface{}{
+		"max_active_leases": 0,
+		"verify_connection": false,
+	})
+	lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+	if n := activeLeases(t, lt, "member"); n != 3 {
+		t.Errorf("expected 3 active leases, got %d", n)
+	}
+}
+
+func TestLimits_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	lt := newLimitsTest(t, map[string]interface{}{"rate_limit": 2, "rate_limit_period": "1h"})
+
+	lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+	lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+
+	resp := lt.request(logical.ReadOperation, "creds/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the rate limit to be enforced")
+	}
+
+	// Other entities have their own limit
+	lt.mustRequest(logical.ReadOperation, "creds/member", "bob", nil)
+
+	// Windows that haven't ended are kept
+	backend := lt.b.(*backend)
+	if err := backend.pruneRateLimits(context.Background(), lt.storage); err != nil {
+		t.Fatal(err)
+	}
+	resp = lt.request(logical.ReadOperation, "creds/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the rate limit to still be enforced")
+	}
+}
+
+func TestLimits_TokensAndGrants(t *testing.T) {
+	t.Parallel()
+
+	lt := newLimitsTest(t, map[string]interface{}{
+		"max_active_leases":        1,
+		"allowed_grantee_user_ids": "user456",
+	})
+	revoke := func(resp *logical.Response) {
+		t.Helper()
+		if _, err := lt.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   lt.storage,
+			Secret:    resp.Secret,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token := lt.mustRequest(logical.ReadOperation, "token/member", "alice", nil)
+	resp := lt.request(logical.UpdateOperation, "grant/member", "alice", map[string]interface{}{"user_id": "user456"})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the active lease limit to be enforced for grants")
+	}
+
+	revoke(token)
+	grant := lt.mustRequest(logical.UpdateOperation, "grant/member", "alice", map[string]interface{}{"user_id": "user456"})
+	resp = lt.request(logical.ReadOperation, "token/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the active lease limit to be enforced for tokens")
+	}
+
+	revoke(grant)
+	if n := activeLeases(t, lt, "member"); n != 0 {
+		t.Errorf("expected no active leases, got %d", n)
+	}
+}
+
+func TestLimits_FailedIssuance(t *testing.T) {
+	t.Parallel()
+
+	lt := newLimitsTest(t, map[string]interface{}{
+		"credential_type":          credentialTypeTrust,
+		"allowed_trustee_user_ids": "user456",
+		"max_active_leases":        1,
+		"rate_limit":               1,
+		"rate_limit_period":        "1h",
+	})
+
+	// A failed read uses up neither the lease nor the rate limit
+	resp := lt.request(logical.ReadOperation, "creds/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected reading a trust without a trustee to fail")
+	}
+	lt.mustRequest(logical.ReadOperation, "creds/member", "alice", map[string]interface{}{"trustee_user_id": "user456"})
+
+	resp = lt.request(logical.ReadOperation, "creds/member", "bob", map[string]interface{}{"trustee_user_id": "user456"})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the active lease limit to be enforced")
+	}
+	resp = lt.request(logical.ReadOperation, "creds/member", "alice", map[string]interface{}{"trustee_user_id": "user456"})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the rate limit to be enforced")
+	}
+}
+
+func TestLimits_RoleSetRecreated(t *testing.T) {
+	t.Parallel()
+
+	lt := newLimitsTest(t, map[string]interface{}{"max_active_leases": 1})
+	revoke := func(resp *logical.Response) {
+		t.Helper()
+		if _, err := lt.b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   lt.storage,
+			Secret:    resp.Secret,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+
+	// A roleset created with the same name starts with no active leases
+	lt.mustRequest(logical.DeleteOperation, "roleset/member", "", nil)
+	lt.mustRequest(logical.UpdateOperation, "roleset/member", "", map[string]interface{}{
+		"project_id":        "project123",
+		"roles":             "member",
+		"max_active_leases": 1,
+		"verify_connection": false,
+	})
+	current := lt.mustRequest(logical.ReadOperation, "creds/member", "alice", nil)
+
+	// Revoking the lease of the deleted roleset leaves the new count alone
+	revoke(old)
+	if n := activeLeases(t, lt, "member"); n != 1 {
+		t.Errorf("expected 1 active lease, got %d", n)
+	}
+	resp := lt.request(logical.ReadOperation, "creds/member", "alice", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected the active lease limit to still be enforced")
+	}
+
+	revoke(current)
+	if n := activeLeases(t, lt, "member"); n != 0 {
+		t.Errorf("expected no active leases, got %d", n)
+	}
+}
+
+func TestRoleSet_LimitValidation(t *testing.T) {
+	t.Parallel()
+
+	for _, field := range []string{"max_active_leases", "rate_limit", "rate_limit_period"} {
+		t.Run(field, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roleset/member",
+				Data: map[string]interface{}{
+					"project_id":        "project123",
+					"verify_connection": false,
+					field:               -1,
+				},
+				Storage: reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatal("expected error response")
+			}
+		})
+	}
+}
@@ -2,11 +2,15 @@ package openstack
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/gophercloud/gophercloud/v2"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/hashicorp/vault/sdk/rotation"
 )
 
 const configAccessKey = "config/auth"
@@ -14,65 +18,7 @@ const configAccessKey = "config/auth"
 func pathConfigAccess(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: configAccessKey,
-		Fields: map[string]*framework.FieldSchema{
-			"auth_url": {
-				Type:        framework.TypeString,
-				Description: "OpenStack authentication URL",
-			},
-			"user_id": {
-				Type:        framework.TypeString,
-				Description: "User ID for authentication",
-			},
-			"username": {
-				Type:        framework.TypeString,
-				Description: "Username for authentication",
-			},
-			"password": {
-				Type:        framework.TypeString,
-				Description: "Password for authentication",
-			},
-			"user_domain_id": {
-				Type:        framework.TypeString,
-				Description: "Domain ID for user authentication",
-			},
-			"user_domain_name": {
-				Type:        framework.TypeString,
-				Description: "Domain name for user authentication",
-			},
-			"application_credential_id": {
-				Type:        framework.TypeString,
-				Description: "Application credential ID for authentication",
-			},
-			"application_credential_name": {
-				Type:        framework.TypeString,
-				Description: "Application credential name for authentication",
-			},
-			"application_credential_secret": {
-				Type:        framework.TypeString,
-				Description: "Application credential secret for authentication",
-			},
-			"region_name": {
-				Type:        framework.TypeString,
-				Description: "Region name for endpoint selection",
-			},
-			"cacert": {
-				Type:        framework.TypeString,
-				Description: "PEM-encoded CA certificate for TLS verification",
-			},
-			"cert": {
-				Type:        framework.TypeString,
-				Description: "PEM-encoded client certificate for mutual TLS",
-			},
-			"key": {
-				Type:        framework.TypeString,
-				Description: "PEM-encoded client key for mutual TLS",
-			},
-			"insecure": {
-				Type:        framework.TypeBool,
-				Description: "Skip TLS verification (not recommended for production)",
-				Default:     false,
-			},
-		},
+		Fields:  configFields(),
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation:   b.pathConfigAccessRead,
 			logical.CreateOperation: b.pathConfigAccessWrite,
@@ -83,6 +29,82 @@ func pathConfigAccess(b *backend) *framework.Path {
 	}
 }
 
+// configFields returns the schema shared by config/auth and config/cloud/<name>.
+func configFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"auth_url": {
+			Type:        framework.TypeString,
+			Description: "OpenStack authentication URL",
+		},
+		"user_id": {
+			Type:        framework.TypeString,
+			Description: "User ID for authentication",
+		},
+		"username": {
+			Type:        framework.TypeString,
+			Description: "Username for authentication",
+		},
+		"password": {
+			Type:        framework.TypeString,
+			Description: "Password for authentication",
+		},
+		"user_domain_id": {
+			Type:        framework.TypeString,
+			Description: "Domain ID for user authentication",
+		},
+		"user_domain_name": {
+			Type:        framework.TypeString,
+			Description: "Domain name for user authentication",
+		},
+		"application_credential_id": {
+			Type:        framework.TypeString,
+			Description: "Application credential ID for authentication",
+		},
+		"application_credential_name": {
+			Type:        framework.TypeString,
+			Description: "Application credential name for authentication",
+		},
+		"application_credential_secret": {
+			Type:        framework.TypeString,
+			Description: "Application credential secret for authentication",
+		},
+		"region_name": {
+			Type:        framework.TypeString,
+			Description: "Region name for endpoint selection",
+		},
+		"cacert": {
+			Type:        framework.TypeString,
+			Description: "PEM-encoded CA certificate for TLS verification",
+		},
+		"cert": {
+			Type:        framework.TypeString,
+			Description: "PEM-encoded client certificate for mutual TLS",
+		},
+		"key": {
+			Type:        framework.TypeString,
+			Description: "PEM-encoded client key for mutual TLS",
+		},
+		"insecure": {
+			Type:        framework.TypeBool,
+			Description: "Skip TLS verification (not recommended for production)",
+			Default:     false,
+		},
+		"rotation_period": {
+			Type:        framework.TypeDurationSecond,
+			Description: "Interval at which the root credential is rotated automatically. Mutually exclusive with rotation_schedule",
+		},
+		"rotation_schedule": {
+			Type:        framework.TypeString,
+			Description: "CRON-style schedule on which the root credential is rotated automatically. Mutually exclusive with rotation_period",
+		},
+		"verify_connection": {
+			Type:        framework.TypeBool,
+			Description: "Authenticate to Keystone before storing the configuration",
+			Default:     true,
+		},
+	}
+}
+
 func (b *backend) configExistenceCheck(ctx context.Context, req *logical.Request, data *framework.FieldData) (bool, error) {
 	entry, err := b.readConfigAccess(ctx, req.Storage)
 	if err != nil {
@@ -109,6 +131,14 @@ func (b *backend) readConfigAccess(ctx context.Context, storage logical.Storage)
 	return conf, nil
 }
 
+func storeConfig(ctx context.Context, storage logical.Storage, key string, cfg *Config) error {
+	entry, err := logical.StorageEntryJSON(key, cfg)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
 func (b *backend) pathConfigAccessRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	conf, err := b.readConfigAccess(ctx, req.Storage)
 	if err != nil {
@@ -119,23 +149,14 @@ func (b *backend) pathConfigAccessRead(ctx context.Context, req *logical.Request
 	}
 
 	return &logical.Response{
-		Data: map[string]interface{}{
-			"auth_url":                    conf.AuthURL,
-			"user_id":                     conf.UserID,
-			"username":                    conf.Username,
-			"user_domain_id":              conf.UserDomainID,
-			"user_domain_name":            conf.UserDomainName,
-			"application_credential_id":   conf.ApplicationCredentialID,
-			"application_credential_name": conf.ApplicationCredentialName,
-			"region_name":                 conf.RegionName,
-			"cacert":                      conf.CACert,
-			"cert":                        conf.Cert,
-			"insecure":                    conf.Insecure,
-		},
+		Data: conf.responseData(),
 	}, nil
 }
 
 func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
 	conf, err := b.readConfigAccess(ctx, req.Storage)
 	if err != nil {
 		return nil, err
@@ -144,47 +165,15 @@ func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Reques
 		conf = &Config{}
 	}
 
-	if authURL, ok := data.GetOk("auth_url"); ok {
-		conf.AuthURL = authURL.(string)
-	}
-	if userID, ok := data.GetOk("user_id"); ok {
-		conf.UserID = userID.(string)
-	}
-	if username, ok := data.GetOk("username"); ok {
-		conf.Username = username.(string)
+	if err := conf.update(data); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
-	if password, ok := data.GetOk("password"); ok {
-		conf.Password = password.(string)
-	}
-	if userDomainID, ok := data.GetOk("user_domain_id"); ok {
-		conf.UserDomainID = userDomainID.(string)
-	}
-	if userDomainName, ok := data.GetOk("user_domain_name"); ok {
-		conf.UserDomainName = userDomainName.(string)
-	}
-	if appCredID, ok := data.GetOk("application_credential_id"); ok {
-		conf.ApplicationCredentialID = appCredID.(string)
-	}
-	if appCredName, ok := data.GetOk("application_credential_name"); ok {
-		conf.ApplicationCredentialName = appCredName.(string)
-	}
-	if appCredSecret, ok := data.GetOk("application_credential_secret"); ok {
-		conf.ApplicationCredentialSecret = appCredSecret.(string)
-	}
-	if regionName, ok := data.GetOk("region_name"); ok {
-		conf.RegionName = regionName.(string)
-	}
-	if cacert, ok := data.GetOk("cacert"); ok {
-		conf.CACert = cacert.(string)
-	}
-	if cert, ok := data.GetOk("cert"); ok {
-		conf.Cert = cert.(string)
-	}
-	if key, ok := data.GetOk("key"); ok {
-		conf.Key = key.(string)
-	}
-	if insecure, ok := data.GetOk("insecure"); ok {
-		conf.Insecure = insecure.(bool)
+
+	var resp *logical.Response
+	if data.Get("verify_connection").(bool) {
+		if resp = verifyConfig(ctx, conf); resp.IsError() {
+			return resp, nil
+		}
 	}
 
 	entry, err := logical.StorageEntryJSON(configAccessKey, conf)
@@ -194,17 +183,57 @@ func (b *backend) pathConfigAccessWrite(ctx context.Context, req *logical.Reques
 	if err := req.Storage.Put(ctx, entry); err != nil {
 		return nil, err
 	}
+	b.resetUserIDs()
+	b.resetClients()
 
-	return nil, nil
+	return resp, nil
 }
 
 func (b *backend) pathConfigAccessDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
 	if err := req.Storage.Delete(ctx, configAccessKey); err != nil {
 		return nil, err
 	}
+	b.resetUserIDs()
+	b.resetClients()
 	return nil, nil
 }
 
+// verifyConfig authenticates with cfg and reports who it authenticated as, or
+// returns an error response describing why authentication failed.
+func verifyConfig(ctx context.Context, cfg *Config) *logical.Response {
+	identityClient, err := client(ctx, cfg, &RoleSet{})
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("unable to authenticate to %s: %s", cfg.AuthURL, authErrorMessage(err)))
+	}
+
+	result, err := authResult(identityClient)
+	if err != nil {
+		return logical.ErrorResponse(err.Error())
+	}
+
+	data := map[string]interface{}{}
+	if user, err := result.ExtractUser(); err == nil && user != nil {
+		data["user_id"] = user.ID
+		data["user_name"] = user.Name
+		data["user_domain_id"] = user.Domain.ID
+		data["user_domain_name"] = user.Domain.Name
+	}
+	if project, err := result.ExtractProject(); err == nil && project != nil {
+		data["project_id"] = project.ID
+		data["project_name"] = project.Name
+		data["project_domain_id"] = project.Domain.ID
+	}
+	if domain, err := result.ExtractDomain(); err == nil && domain != nil {
+		data["domain_id"] = domain.ID
+		data["domain_name"] = domain.Name
+	}
+
+	return &logical.Response{Data: data}
+}
+
 type Config struct {
 	AuthURL                     string `json:"auth_url"`
 	UserID                      string `json:"user_id"`
@@ -220,13 +249,94 @@ type Config struct {
 	Cert                        string `json:"cert"`
 	Key                         string `json:"key"`
 	Insecure                    bool   `json:"insecure"`
+
+	RotationPeriod   time.Duration `json:"rotation_period,omitempty"`
+	RotationSchedule string        `json:"rotation_schedule,omitempty"`
+	LastRotated      time.Time     `json:"last_rotated,omitempty"`
+
+	// RotationFailures counts the automatic rotations that failed in a row
+	// since LastRotated; the next attempt is delayed accordingly.
+	RotationFailures    int       `json:"rotation_failures,omitempty"`
+	LastRotationFailure time.Time `json:"last_rotation_failure,omitempty"`
+	LastRotationError   string    `json:"last_rotation_error,omitempty"`
+
+	// PendingPassword and PendingApplicationCredential hold the secret a
+	// root rotation is switching to until Keystone has confirmed the change.
+	PendingPassword              string                        `json:"pending_password,omitempty"`
+	PendingApplicationCredential *pendingApplicationCredential `json:"pending_application_credential,omitempty"`
+}
+
+// identityKey identifies the user the config authenticates as, independent
+// of its secret.
+func (c *Config) identityKey() string {
+	return strings.Join([]string{
+		c.AuthURL,
+		c.UserID,
+		c.Username,
+		c.UserDomainID,
+		c.UserDomainName,
+		c.ApplicationCredentialID,
+		c.ApplicationCredentialName,
+	}, "\x00")
 }
 
 func (c *Config) UsesApplicationCredential() bool {
 	return c.ApplicationCredentialID != "" || c.ApplicationCredentialName != ""
 }
 
-func (c *Config) AuthOptions(projectID, projectName string) *gophercloud.AuthOptions {
+// NextRotation returns when the root credential is next due for automatic
+// rotation, or the zero time if automatic rotation is disabled. A credential
+// that has never been rotated is due immediately, and one whose last
+// automatic rotation failed is retried after a backoff.
+func (c *Config) NextRotation() time.Time {
+	next := c.scheduledRotation()
+	if next.IsZero() || c.RotationFailures == 0 {
+		return next
+	}
+
+	backoff := rootRotationMaxBackoff
+	if c.RotationFailures <= 10 {
+		backoff = min(rootRotationBackoff<<(c.RotationFailures-1), rootRotationMaxBackoff)
+	}
+	if retry := c.LastRotationFailure.Add(backoff); retry.After(next) {
+		return retry
+	}
+	return next
+}
+
+// scheduledRotation returns when the rotation period or schedule next makes
+// the root credential due, ignoring failed attempts.
+func (c *Config) scheduledRotation() time.Time {
+	switch {
+	case c.RotationPeriod > 0:
+		if c.LastRotated.IsZero() {
+			return time.Now()
+		}
+		return c.LastRotated.Add(c.RotationPeriod)
+	case c.RotationSchedule != "":
+		schedule, err := rotation.DefaultScheduler.Parse(c.RotationSchedule)
+		if err != nil {
+			return time.Time{}
+		}
+		if c.LastRotated.IsZero() {
+			return time.Now()
+		}
+		return schedule.Next(c.LastRotated)
+	}
+	return time.Time{}
+}
+
+// rotated records that the root credential was just replaced.
+func (c *Config) rotated() {
+	c.LastRotated = time.Now()
+	c.RotationFailures = 0
+	c.LastRotationFailure = time.Time{}
+	c.LastRotationError = ""
+}
+
+// AuthOptions returns the options to authenticate with, scoped as the
+// roleset requires.
+func (c *Config) AuthOptions(role *RoleSet) *gophercloud.AuthOptions {
 	return &gophercloud.AuthOptions{
 		IdentityEndpoint:            c.AuthURL,
 		UserID:                      c.UserID,
@@ -234,10 +344,107 @@ func (c *Config) AuthOptions(projectID, projectName string) *gophercloud.AuthOpt
 		Password:                    c.Password,
 		DomainID:                    c.UserDomainID,
 		DomainName:                  c.UserDomainName,
-		TenantID:                    projectID,
-		TenantName:                  projectName,
 		ApplicationCredentialID:     c.ApplicationCredentialID,
 		ApplicationCredentialName:   c.ApplicationCredentialName,
 		ApplicationCredentialSecret: c.ApplicationCredentialSecret,
+		Scope:                       role.authScope(c),
+	}
+}
+
+// update sets the fields present in the request data on the configuration.
+func (c *Config) update(data *framework.FieldData) error {
+	if authURL, ok := data.GetOk("auth_url"); ok {
+		c.AuthURL = authURL.(string)
+	}
+	if userID, ok := data.GetOk("user_id"); ok {
+		c.UserID = userID.(string)
+	}
+	if username, ok := data.GetOk("username"); ok {
+		c.Username = username.(string)
+	}
+	if password, ok := data.GetOk("password"); ok {
+		c.Password = password.(string)
+		c.PendingPassword = ""
+		c.rotated()
 	}
+	if userDomainID, ok := data.GetOk("user_domain_id"); ok {
+		c.UserDomainID = userDomainID.(string)
+	}
+	if userDomainName, ok := data.GetOk("user_domain_name"); ok {
+		c.UserDomainName = userDomainName.(string)
+	}
+	if appCredID, ok := data.GetOk("application_credential_id"); ok {
+		c.ApplicationCredentialID = appCredID.(string)
+	}
+	if appCredName, ok := data.GetOk("application_credential_name"); ok {
+		c.ApplicationCredentialName = appCredName.(string)
+	}
+	if appCredSecret, ok := data.GetOk("application_credential_secret"); ok {
+		c.ApplicationCredentialSecret = appCredSecret.(string)
+		c.PendingApplicationCredential = nil
+		c.rotated()
+	}
+	if regionName, ok := data.GetOk("region_name"); ok {
+		c.RegionName = regionName.(string)
+	}
+	if cacert, ok := data.GetOk("cacert"); ok {
+		c.CACert = cacert.(string)
+	}
+	if cert, ok := data.GetOk("cert"); ok {
+		c.Cert = cert.(string)
+	}
+	if key, ok := data.GetOk("key"); ok {
+		c.Key = key.(string)
+	}
+	if insecure, ok := data.GetOk("insecure"); ok {
+		c.Insecure = insecure.(bool)
+	}
+	if rotationPeriod, ok := data.GetOk("rotation_period"); ok {
+		c.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+	}
+	if rotationSchedule, ok := data.GetOk("rotation_schedule"); ok {
+		c.RotationSchedule = rotationSchedule.(string)
+		if c.RotationSchedule != "" {
+			if _, err := rotation.DefaultScheduler.Parse(c.RotationSchedule); err != nil {
+				return fmt.Errorf("invalid rotation_schedule: %w", err)
+			}
+		}
+	}
+	if c.RotationPeriod > 0 && c.RotationSchedule != "" {
+		return errors.New("rotation_period and rotation_schedule are mutually exclusive")
+	}
+
+	return nil
+}
+
+// responseData returns the configuration without its secrets.
+func (c *Config) responseData() map[string]interface{} {
+	data := map[string]interface{}{
+		"auth_url":                    c.AuthURL,
+		"user_id":                     c.UserID,
+		"username":                    c.Username,
+		"user_domain_id":              c.UserDomainID,
+		"user_domain_name":            c.UserDomainName,
+		"application_credential_id":   c.ApplicationCredentialID,
+		"application_credential_name": c.ApplicationCredentialName,
+		"region_name":                 c.RegionName,
+		"cacert":                      c.CACert,
+		"cert":                        c.Cert,
+		"insecure":                    c.Insecure,
+		"rotation_period":             int64(c.RotationPeriod.Seconds()),
+		"rotation_schedule":           c.RotationSchedule,
+	}
+	if !c.LastRotated.IsZero() {
+		data["last_rotated"] = c.LastRotated.Format(time.RFC3339)
+	}
+	if c.RotationFailures > 0 {
+		data["rotation_failures"] = c.RotationFailures
+		data["last_rotation_failure"] = c.LastRotationFailure.Format(time.RFC3339)
+		data["last_rotation_error"] = c.LastRotationError
+	}
+	if next := c.NextRotation(); !next.IsZero() {
+		data["next_rotation"] = next.Format(time.RFC3339)
+	}
+
+	return data
 }
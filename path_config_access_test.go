@@ -2,8 +2,15 @@ package openstack
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gophercloud/gophercloud/v2"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
@@ -42,6 +49,7 @@ func TestConfigAccess_CreateAndRead(t *testing.T) {
 		"application_credential_name":   "myappcred",
 		"application_credential_secret": "secret123",
 		"region_name":                   "RegionOne",
+		"verify_connection":             false,
 	}
 
 	resp, err := b.HandleRequest(context.Background(), &logical.Request{
@@ -86,10 +94,17 @@ func TestConfigAccess_CreateAndRead(t *testing.T) {
 		"cacert":                      "",
 		"cert":                        "",
 		"insecure":                    false,
+		"rotation_period":             int64(0),
+		"rotation_schedule":           "",
 	}
 
-	if len(resp.Data) != len(expected) {
-		t.Errorf("expected %d fields, got %d", len(expected), len(resp.Data))
+	// Writing a secret records when it was last rotated
+	if _, ok := resp.Data["last_rotated"]; !ok {
+		t.Error("expected last_rotated in response")
+	}
+
+	if len(resp.Data) != len(expected)+1 {
+		t.Errorf("expected %d fields, got %d", len(expected)+1, len(resp.Data))
 	}
 
 	for k, expectedV := range expected {
@@ -166,7 +181,7 @@ func TestConfig_AuthOptions(t *testing.T) {
 		ApplicationCredentialSecret: "appsecret",
 	}
 
-	authOpts := cfg.AuthOptions("project123", "myproject")
+	authOpts := cfg.AuthOptions(&RoleSet{ProjectID: "project123"})
 
 	if authOpts.IdentityEndpoint != cfg.AuthURL {
 		t.Errorf("IdentityEndpoint = %q, expected %q", authOpts.IdentityEndpoint, cfg.AuthURL)
@@ -186,11 +201,8 @@ func TestConfig_AuthOptions(t *testing.T) {
 	if authOpts.DomainName != cfg.UserDomainName {
 		t.Errorf("DomainName = %q, expected %q", authOpts.DomainName, cfg.UserDomainName)
 	}
-	if authOpts.TenantID != "project123" {
-		t.Errorf("TenantID = %q, expected %q", authOpts.TenantID, "project123")
-	}
-	if authOpts.TenantName != "myproject" {
-		t.Errorf("TenantName = %q, expected %q", authOpts.TenantName, "myproject")
+	if authOpts.Scope == nil || authOpts.Scope.ProjectID != "project123" {
+		t.Errorf("Scope = %#v, expected project scope %q", authOpts.Scope, "project123")
 	}
 	if authOpts.ApplicationCredentialID != cfg.ApplicationCredentialID {
 		t.Errorf("ApplicationCredentialID = %q, expected %q", authOpts.ApplicationCredentialID, cfg.ApplicationCredentialID)
@@ -202,3 +214,518 @@ func TestConfig_AuthOptions(t *testing.T) {
 		t.Errorf("ApplicationCredentialSecret = %q, expected %q", authOpts.ApplicationCredentialSecret, cfg.ApplicationCredentialSecret)
 	}
 }
+
+func TestConfigRotateRoot_NoConfig(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response without access config")
+	}
+}
+
+func TestConfigAccess_RotationSettings(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	// rotation_period and rotation_schedule are mutually exclusive
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"rotation_period":   "720h",
+			"rotation_schedule": "0 0 * * *",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for both rotation_period and rotation_schedule")
+	}
+
+	// Invalid schedules are rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"rotation_schedule": "not a schedule",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for invalid rotation_schedule")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url":          "http://keystone:5000",
+			"password":          "secret",
+			"rotation_period":   "720h",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error response: %v", resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      configAccessKey,
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on read: %v", err)
+	}
+	if resp.Data["rotation_period"] != int64(720*60*60) {
+		t.Errorf("rotation_period = %v, expected %v", resp.Data["rotation_period"], int64(720*60*60))
+	}
+	lastRotated, err := time.Parse(time.RFC3339, resp.Data["last_rotated"].(string))
+	if err != nil {
+		t.Fatalf("unable to parse last_rotated: %v", err)
+	}
+	nextRotation, err := time.Parse(time.RFC3339, resp.Data["next_rotation"].(string))
+	if err != nil {
+		t.Fatalf("unable to parse next_rotation: %v", err)
+	}
+	if !nextRotation.Equal(lastRotated.Add(720 * time.Hour)) {
+		t.Errorf("next_rotation = %v, expected %v", nextRotation, lastRotated.Add(720*time.Hour))
+	}
+}
+
+func TestConfig_NextRotation(t *testing.T) {
+	t.Parallel()
+
+	lastRotated := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		config   Config
+		expected time.Time
+	}{
+		{
+			name:     "disabled",
+			config:   Config{LastRotated: lastRotated},
+			expected: time.Time{},
+		},
+		{
+			name:     "period",
+			config:   Config{RotationPeriod: 30 * 24 * time.Hour, LastRotated: lastRotated},
+			expected: lastRotated.Add(30 * 24 * time.Hour),
+		},
+		{
+			name:     "schedule",
+			config:   Config{RotationSchedule: "0 0 1 * *", LastRotated: lastRotated},
+			expected: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "failed rotation backs off",
+			config: Config{
+				RotationPeriod:      time.Hour,
+				LastRotated:         lastRotated,
+				RotationFailures:    3,
+				LastRotationFailure: lastRotated.Add(2 * time.Hour),
+			},
+			expected: lastRotated.Add(2*time.Hour + 4*rootRotationBackoff),
+		},
+		{
+			name: "failed rotation backoff is capped",
+			config: Config{
+				RotationPeriod:      time.Hour,
+				LastRotated:         lastRotated,
+				RotationFailures:    100,
+				LastRotationFailure: lastRotated.Add(2 * time.Hour),
+			},
+			expected: lastRotated.Add(2*time.Hour + rootRotationMaxBackoff),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.NextRotation(); !got.Equal(tc.expected) {
+				t.Errorf("NextRotation() = %v, expected %v", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestBackend_UserIDCache(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	backend := b.(*backend)
+
+	cfg := &Config{
+		AuthURL:        "http://keystone:5000",
+		Username:       "admin",
+		UserDomainName: "Default",
+		Password:       "secret",
+	}
+
+	// Cached IDs are returned without touching the identity client
+	backend.userIDs[cfg.identityKey()] = "user123"
+	userID, err := backend.userID(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userID != "user123" {
+		t.Errorf("userID = %q, expected %q", userID, "user123")
+	}
+
+	// The secret is not part of the identity
+	rotated := *cfg
+	rotated.Password = "rotated"
+	if rotated.identityKey() != cfg.identityKey() {
+		t.Error("expected identity key to ignore the password")
+	}
+
+	other := *cfg
+	other.Username = "other"
+	if other.identityKey() == cfg.identityKey() {
+		t.Error("expected identity key to differ between users")
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/auth",
+		Data: map[string]interface{}{
+			"auth_url":          "http://keystone:5000",
+			"username":          "admin",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend.userIDLock.RLock()
+	defer backend.userIDLock.RUnlock()
+	if len(backend.userIDs) != 0 {
+		t.Errorf("expected config write to reset the user ID cache, got %v", backend.userIDs)
+	}
+}
+
+func TestBackend_ClientCache(t *testing.T) {
+	t.Parallel()
+
+	b, _ := getTestBackend(t)
+	backend := b.(*backend)
+	ks := newTestKeystone(t)
+
+	cfg := &Config{
+		AuthURL:        ks.URL + "/v3",
+		Username:       "svc",
+		UserDomainName: "Default",
+		Password:       "secret",
+	}
+	role := &RoleSet{ProjectID: "project123"}
+
+	first, err := backend.cachedClient(context.Background(), cfg, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := backend.cachedClient(context.Background(), cfg, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("expected the client to be reused")
+	}
+	if n := ks.authCount.Load(); n != 1 {
+		t.Errorf("expected 1 authentication, got %d", n)
+	}
+
+	// Other scopes and rotated secrets get their own client
+	if _, err := backend.cachedClient(context.Background(), cfg, &RoleSet{ProjectID: "project456"}); err != nil {
+		t.Fatal(err)
+	}
+	rotated := *cfg
+	rotated.Password = "rotated"
+	if _, err := backend.cachedClient(context.Background(), &rotated, role); err != nil {
+		t.Fatal(err)
+	}
+	if n := ks.authCount.Load(); n != 3 {
+		t.Errorf("expected 3 authentications, got %d", n)
+	}
+
+	// Clients with tokens about to expire are replaced
+	key, err := clientKey(cfg, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.clients[key].expiresAt = time.Now().Add(time.Minute)
+	if _, err := backend.cachedClient(context.Background(), cfg, role); err != nil {
+		t.Fatal(err)
+	}
+	if n := ks.authCount.Load(); n != 4 {
+		t.Errorf("expected 4 authentications, got %d", n)
+	}
+
+	// Expired clients are pruned when another client is cached
+	rotatedKey, err := clientKey(&rotated, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.clients[rotatedKey].expiresAt = time.Now().Add(-time.Minute)
+	if _, err := backend.cachedClient(context.Background(), cfg, &RoleSet{ProjectID: "project789"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := backend.clients[rotatedKey]; ok {
+		t.Error("expected the expired client to be pruned")
+	}
+	if n := len(backend.clients); n != 3 {
+		t.Errorf("expected 3 cached clients, got %d", n)
+	}
+
+	// Changes to access configs on other nodes drop the cache
+	backend.invalidate(context.Background(), configCloudPrefix+"regionone")
+	backend.clientLock.RLock()
+	defer backend.clientLock.RUnlock()
+	if len(backend.clients) != 0 {
+		t.Errorf("expected invalidation to reset the client cache, got %d clients", len(backend.clients))
+	}
+}
+
+func TestConfigAccess_VerifyConnection(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url": "http://127.0.0.1:1/v3",
+			"user_id":  "admin",
+			"password": "secret",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response for unreachable endpoint, got %#v", resp)
+	}
+
+	cfg, err := b.(*backend).readConfigAccess(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != nil {
+		t.Fatal("expected config to not be stored when verification fails")
+	}
+}
+
+func TestAuthErrorMessage(t *testing.T) {
+	t.Parallel()
+
+	unauthorized := gophercloud.ErrUnexpectedResponseCode{Actual: http.StatusUnauthorized}
+	if msg := authErrorMessage(unauthorized); msg != "the credentials were rejected by Keystone" {
+		t.Errorf("unexpected message for 401: %q", msg)
+	}
+
+	unreachable := &url.Error{Op: "Post", URL: "http://keystone:5000/v3/auth/tokens", Err: errors.New("connection refused")}
+	if msg := authErrorMessage(unreachable); !strings.HasPrefix(msg, "the endpoint could not be reached") {
+		t.Errorf("unexpected message for unreachable endpoint: %q", msg)
+	}
+
+	untrusted := &url.Error{Op: "Post", URL: "https://keystone:5000/v3/auth/tokens", Err: x509.UnknownAuthorityError{}}
+	if msg := authErrorMessage(untrusted); !strings.HasPrefix(msg, "TLS verification failed") {
+		t.Errorf("unexpected message for untrusted certificate: %q", msg)
+	}
+}
+
+func TestConfigRotateRoot_Cloud(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+	original := "secret"
+	ks.password.Store(&original)
+
+	for _, req := range []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      configCloudPrefix + "other",
+			Data: map[string]interface{}{
+				"auth_url":          ks.URL + "/v3",
+				"username":          "svc",
+				"user_domain_id":    "default",
+				"password":          original,
+				"verify_connection": false,
+			},
+		},
+		{
+			Operation: logical.UpdateOperation,
+			Path:      configCloudPrefix + "other/rotate-root",
+		},
+	} {
+		req.Storage = reqStorage
+		resp, err := b.HandleRequest(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatal(resp.Error())
+		}
+	}
+
+	cfg, err := b.(*backend).readConfigCloud(context.Background(), reqStorage, "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Password == original || cfg.Password != *ks.password.Load() {
+		t.Errorf("expected the stored password to be the rotated one")
+	}
+	if cfg.PendingPassword != "" {
+		t.Errorf("expected no pending password, got %q", cfg.PendingPassword)
+	}
+}
+
+func TestConfigRotateRoot_PendingPassword(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		applied bool
+	}{
+		{name: "change applied in keystone", applied: true},
+		{name: "change never reached keystone", applied: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+			ks := newTestKeystone(t)
+
+			// A rotation that stopped after saving the pending password
+			current := "old"
+			if tc.applied {
+				current = "new"
+			}
+			ks.password.Store(&current)
+			if err := storeConfig(context.Background(), reqStorage, configAccessKey, &Config{
+				AuthURL:         ks.URL + "/v3",
+				Username:        "svc",
+				UserDomainID:    "default",
+				Password:        "old",
+				PendingPassword: "new",
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "config/rotate-root",
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp != nil && resp.IsError() {
+				t.Fatal(resp.Error())
+			}
+
+			cfg, err := b.(*backend).readConfigAccess(context.Background(), reqStorage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Password != *ks.password.Load() {
+				t.Errorf("stored password does not match keystone")
+			}
+			if cfg.PendingPassword != "" {
+				t.Errorf("expected no pending password, got %q", cfg.PendingPassword)
+			}
+		})
+	}
+}
+
+func TestConfigRotateRoot_ScheduledFailureBacksOff(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+	current := "secret"
+	ks.password.Store(&current)
+
+	// A due rotation whose stored password Keystone no longer accepts
+	if err := storeConfig(context.Background(), reqStorage, configAccessKey, &Config{
+		AuthURL:        ks.URL + "/v3",
+		Username:       "svc",
+		UserDomainID:   "default",
+		Password:       "stale",
+		RotationPeriod: time.Hour,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.(*backend).rotateDueRootCredentials(context.Background(), reqStorage); err == nil {
+		t.Fatal("expected the scheduled rotation to fail")
+	}
+
+	cfg, err := b.(*backend).readConfigAccess(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RotationFailures != 1 || cfg.LastRotationError == "" {
+		t.Fatalf("expected the failure to be recorded, got %d failures and error %q", cfg.RotationFailures, cfg.LastRotationError)
+	}
+	if next := cfg.NextRotation(); !next.After(time.Now()) {
+		t.Errorf("expected the retry to be delayed, next rotation is %v", next)
+	}
+
+	// The next tick waits for the backoff instead of retrying
+	if err := b.(*backend).rotateDueRootCredentials(context.Background(), reqStorage); err != nil {
+		t.Fatalf("expected no retry during the backoff, got %v", err)
+	}
+	cfg, err = b.(*backend).readConfigAccess(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RotationFailures != 1 {
+		t.Errorf("expected 1 recorded failure, got %d", cfg.RotationFailures)
+	}
+
+	// Fixing the password clears the failure
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Storage:   reqStorage,
+		Data: map[string]interface{}{
+			"password":          current,
+			"verify_connection": false,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v, resp: %v", err, resp)
+	}
+	cfg, err = b.(*backend).readConfigAccess(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RotationFailures != 0 || cfg.LastRotationError != "" {
+		t.Errorf("expected the failure to be cleared, got %d failures and error %q", cfg.RotationFailures, cfg.LastRotationError)
+	}
+}
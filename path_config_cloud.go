@@ -0,0 +1,247 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const configCloudPrefix = "config/cloud/"
+
+func pathListConfigClouds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/cloud/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathConfigCloudList,
+		},
+	}
+}
+
+func pathConfigCloud(b *backend) *framework.Path {
+	fields := configFields()
+	fields["name"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "Name of the cloud",
+	}
+
+	return &framework.Path{
+		Pattern: configCloudPrefix + framework.GenericNameRegex("name"),
+		Fields:  fields,
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigCloudRead,
+			logical.CreateOperation: b.pathConfigCloudWrite,
+			logical.UpdateOperation: b.pathConfigCloudWrite,
+			logical.DeleteOperation: b.pathConfigCloudDelete,
+		},
+		ExistenceCheck:  b.configCloudExistenceCheck,
+		HelpSynopsis:    pathConfigCloudHelpSyn,
+		HelpDescription: pathConfigCloudHelpDesc,
+	}
+}
+
+func (b *backend) configCloudExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	entry, err := b.readConfigCloud(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return entry != nil, nil
+}
+
+func (b *backend) readConfigCloud(ctx context.Context, storage logical.Storage, name string) (*Config, error) {
+	entry, err := storage.Get(ctx, configCloudPrefix+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	conf := &Config{}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, fmt.Errorf("error reading OpenStack cloud configuration: %w", err)
+	}
+
+	return conf, nil
+}
+
+// configForRole returns the access configuration a roleset authenticates
+// with: its named cloud if set, otherwise config/auth.
+func (b *backend) configForRole(ctx context.Context, storage logical.Storage, role *RoleSet) (*Config, error) {
+	if role.Cloud == "" {
+		return b.readConfigAccess(ctx, storage)
+	}
+	return b.readConfigCloud(ctx, storage, role.Cloud)
+}
+
+func (b *backend) pathConfigCloudList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, configCloudPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathConfigCloudRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := b.readConfigCloud(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: conf.responseData(),
+	}, nil
+}
+
+func (b *backend) pathConfigCloudWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	name := d.Get("name").(string)
+
+	conf, err := b.readConfigCloud(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if conf == nil {
+		conf = &Config{}
+	}
+
+	if err := conf.update(d); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var resp *logical.Response
+	if d.Get("verify_connection").(bool) {
+		if resp = verifyConfig(ctx, conf); resp.IsError() {
+			return resp, nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(configCloudPrefix+name, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+	b.resetUserIDs()
+	b.resetClients()
+
+	return resp, nil
+}
+
+func (b *backend) pathConfigCloudDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	name := d.Get("name").(string)
+
+	users, err := b.cloudUsers(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf("cloud %q is still in use by %s", name, strings.Join(users, ", "))), nil
+	}
+
+	if err := req.Storage.Delete(ctx, configCloudPrefix+name); err != nil {
+		return nil, err
+	}
+	b.resetUserIDs()
+	b.resetClients()
+	return nil, nil
+}
+
+// cloudUsers describes the rolesets, static roles and library sets that
+// issue credentials from the named cloud, and the credentials it issued that
+// are still leased.
+func (b *backend) cloudUsers(ctx context.Context, storage logical.Storage, name string) ([]string, error) {
+	var users []string
+
+	rolesets, err := storage.List(ctx, "roleset/")
+	if err != nil {
+		return nil, err
+	}
+	for _, roleset := range rolesets {
+		role, err := b.Role(ctx, storage, roleset)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Cloud == name {
+			users = append(users, fmt.Sprintf("roleset %q", roleset))
+		}
+	}
+
+	staticRoles, err := storage.List(ctx, staticRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, staticRoleName := range staticRoles {
+		role, err := b.staticRole(ctx, storage, staticRoleName)
+		if err != nil {
+			return nil, err
+		}
+		if role != nil && role.Cloud == name {
+			users = append(users, fmt.Sprintf("static role %q", staticRoleName))
+		}
+	}
+
+	librarySets, err := storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, setName := range librarySets {
+		set, err := b.librarySet(ctx, storage, setName)
+		if err != nil {
+			return nil, err
+		}
+		if set != nil && set.Cloud == name {
+			users = append(users, fmt.Sprintf("library set %q", setName))
+		}
+	}
+
+	ids, err := storage.List(ctx, issuedCredentialPrefix)
+	if err != nil {
+		return nil, err
+	}
+	leased := 0
+	for _, id := range ids {
+		entry, err := storage.Get(ctx, issuedCredentialPrefix+id)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		credential := &issuedCredential{}
+		if err := entry.DecodeJSON(credential); err != nil {
+			return nil, err
+		}
+		if credential.Cloud == name {
+			leased++
+		}
+	}
+	if leased > 0 {
+		users = append(users, fmt.Sprintf("%d leased application credentials", leased))
+	}
+
+	return users, nil
+}
+
+var pathConfigCloudHelpSyn = "Configure a named OpenStack cloud connection"
+
+var pathConfigCloudHelpDesc = `
+Stores the access configuration for an additional OpenStack cloud or region.
+Rolesets select a cloud with their "cloud" field; rolesets without one use
+config/auth. A cloud cannot be deleted while rolesets, static roles or library
+sets use it, or while application credentials it issued are still leased.
+`
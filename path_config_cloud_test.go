@@ -0,0 +1,219 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestConfigCloud_CRUD(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      configCloudPrefix + "regionone",
+		Data: map[string]interface{}{
+			"auth_url":          "http://keystone-one:5000",
+			"user_id":           "admin",
+			"password":          "secret",
+			"region_name":       "RegionOne",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on create: %v", err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatalf("unexpected error response: %v", resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      configCloudPrefix + "regionone",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on read: %v", err)
+	}
+	if resp == nil {
+		t.Fatal("expected response")
+	}
+	if resp.Data["auth_url"] != "http://keystone-one:5000" {
+		t.Errorf("auth_url = %v, expected %v", resp.Data["auth_url"], "http://keystone-one:5000")
+	}
+	if resp.Data["region_name"] != "RegionOne" {
+		t.Errorf("region_name = %v, expected %v", resp.Data["region_name"], "RegionOne")
+	}
+	if _, ok := resp.Data["password"]; ok {
+		t.Error("password should not be returned")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "config/cloud/",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on list: %v", err)
+	}
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "regionone" {
+		t.Errorf("expected [regionone], got %v", keys)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      configCloudPrefix + "regionone",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on delete: %v", err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      configCloudPrefix + "regionone",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error on read: %v", err)
+	}
+	if resp != nil {
+		t.Fatal("expected nil response after deletion")
+	}
+}
+
+func TestConfigCloud_RoleSelection(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	for path, authURL := range map[string]string{
+		configAccessKey:                 "http://keystone-default:5000",
+		configCloudPrefix + "regiontwo": "http://keystone-two:5000",
+	} {
+		_, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      map[string]interface{}{"auth_url": authURL, "verify_connection": false},
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rolesets referencing an unknown cloud are rejected
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data:      map[string]interface{}{"cloud": "missing"},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for unknown cloud")
+	}
+
+	tests := []struct {
+		name     string
+		role     RoleSet
+		expected string
+	}{
+		{
+			name:     "default",
+			role:     RoleSet{},
+			expected: "http://keystone-default:5000",
+		},
+		{
+			name:     "named cloud",
+			role:     RoleSet{Cloud: "regiontwo"},
+			expected: "http://keystone-two:5000",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := b.(*backend).configForRole(context.Background(), reqStorage, &tc.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg == nil {
+				t.Fatal("expected config")
+			}
+			if cfg.AuthURL != tc.expected {
+				t.Errorf("AuthURL = %q, expected %q", cfg.AuthURL, tc.expected)
+			}
+		})
+	}
+}
+
+func TestConfigCloud_DeleteInUse(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, configCloudPrefix+"regiontwo", map[string]interface{}{
+		"auth_url":          "http://keystone-two:5000",
+		"verify_connection": false,
+	})
+	request(logical.UpdateOperation, "roleset/test", map[string]interface{}{
+		"cloud":             "regiontwo",
+		"verify_connection": false,
+	})
+
+	resp := request(logical.DeleteOperation, configCloudPrefix+"regiontwo", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected deleting a cloud used by a roleset to be refused")
+	}
+
+	// A credential issued from the cloud outlives its roleset
+	request(logical.DeleteOperation, "roleset/test", nil)
+	if err := b.(*backend).putIssuedCredential(context.Background(), reqStorage, "cred123", &issuedCredential{
+		RoleSet:   "test",
+		Cloud:     "regiontwo",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = request(logical.DeleteOperation, configCloudPrefix+"regiontwo", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected deleting a cloud with leased credentials to be refused")
+	}
+
+	if err := reqStorage.Delete(context.Background(), issuedCredentialPrefix+"cred123"); err != nil {
+		t.Fatal(err)
+	}
+	if resp := request(logical.DeleteOperation, configCloudPrefix+"regiontwo", nil); resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+	cfg, err := b.(*backend).readConfigCloud(context.Background(), reqStorage, "regiontwo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg != nil {
+		t.Error("expected the cloud to be deleted")
+	}
+}
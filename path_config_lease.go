@@ -18,6 +18,10 @@ func pathConfigLease(b *backend) *framework.Path {
 				Type:        framework.TypeDurationSecond,
 				Description: "Duration after which the issued credential is revoked",
 			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum duration the issued credential can be renewed for",
+			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation:   b.pathLeaseRead,
@@ -32,7 +36,8 @@ func pathConfigLease(b *backend) *framework.Path {
 // Sets the lease configuration parameters
 func (b *backend) pathLeaseUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	entry, err := logical.StorageEntryJSON("config/lease", &configLease{
-		TTL: time.Second * time.Duration(d.Get("ttl").(int)),
+		TTL:    time.Second * time.Duration(d.Get("ttl").(int)),
+		MaxTTL: time.Second * time.Duration(d.Get("max_ttl").(int)),
 	})
 	if err != nil {
 		return nil, err
@@ -64,7 +69,8 @@ func (b *backend) pathLeaseRead(ctx context.Context, req *logical.Request, data
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"ttl": int64(lease.TTL.Seconds()),
+			"ttl":     int64(lease.TTL.Seconds()),
+			"max_ttl": int64(lease.MaxTTL.Seconds()),
 		},
 	}, nil
 }
@@ -89,7 +95,8 @@ func (b *backend) LeaseConfig(ctx context.Context, s logical.Storage) (*configLe
 
 // Lease configuration information for the secrets issued by this backend
 type configLease struct {
-	TTL time.Duration `json:"ttl"`
+	TTL    time.Duration `json:"ttl"`
+	MaxTTL time.Duration `json:"max_ttl"`
 }
 
 var pathConfigLeaseHelpSyn = "Configure the lease parameters for generated tokens"
@@ -97,4 +104,6 @@ var pathConfigLeaseHelpSyn = "Configure the lease parameters for generated token
 var pathConfigLeaseHelpDesc = `
 Sets the ttl values for the applicationCredentials to be issued by the openstack.
 It takes in an integer number of seconds as input as well as inputs like "1h".
+The max_ttl bounds how long a lease can be renewed for and is used as the
+expiry of the application credential in Keystone. Rolesets can override both.
 `
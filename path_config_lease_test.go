@@ -36,7 +36,8 @@ func TestConfigLease_CreateAndRead(t *testing.T) {
 		Operation: logical.UpdateOperation,
 		Path:      leaseConfigKey,
 		Data: map[string]interface{}{
-			"ttl": int64(3600),
+			"ttl":     int64(3600),
+			"max_ttl": int64(7200),
 		},
 		Storage: reqStorage,
 	})
@@ -66,6 +67,9 @@ func TestConfigLease_CreateAndRead(t *testing.T) {
 	if resp.Data["ttl"] != int64(3600) {
 		t.Errorf("ttl = %v, expected %v", resp.Data["ttl"], int64(3600))
 	}
+	if resp.Data["max_ttl"] != int64(7200) {
+		t.Errorf("max_ttl = %v, expected %v", resp.Data["max_ttl"], int64(7200))
+	}
 }
 
 func TestConfigLease_Update(t *testing.T) {
@@ -0,0 +1,447 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const rootPasswordLength = 32
+
+const (
+	// rootRotationBackoff is how long a failed automatic rotation waits
+	// before its first retry; each further failure doubles it up to
+	// rootRotationMaxBackoff.
+	rootRotationBackoff    = 5 * time.Minute
+	rootRotationMaxBackoff = 24 * time.Hour
+)
+
+func pathConfigRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/rotate-root",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConfigRotateRootUpdate,
+		},
+		HelpSynopsis:    pathConfigRotateRootHelpSyn,
+		HelpDescription: pathConfigRotateRootHelpDesc,
+	}
+}
+
+func pathConfigCloudRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: configCloudPrefix + framework.GenericNameRegex("name") + "/rotate-root",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the cloud",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConfigCloudRotateRootUpdate,
+		},
+		HelpSynopsis:    pathConfigRotateRootHelpSyn,
+		HelpDescription: pathConfigRotateRootHelpDesc,
+	}
+}
+
+// pendingApplicationCredential is a replacement root application credential
+// that may have been created in Keystone but isn't in use yet.
+type pendingApplicationCredential struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret"`
+}
+
+func (b *backend) pathConfigRotateRootUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	cfg, err := b.readConfigAccess(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("access config not found"), nil
+	}
+
+	return b.rotateRootCredential(ctx, req.Storage, configAccessKey, cfg)
+}
+
+func (b *backend) pathConfigCloudRotateRootUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	cfg, err := b.readConfigCloud(ctx, req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cloud config: %w", err)
+	}
+	if cfg == nil {
+		return logical.ErrorResponse(fmt.Sprintf("cloud %q not found", name)), nil
+	}
+
+	return b.rotateRootCredential(ctx, req.Storage, configCloudPrefix+name, cfg)
+}
+
+// rotateRootCredential replaces the password or application credential of
+// cfg in Keystone and stores the updated configuration under key. The caller
+// must hold rotationLock.
+func (b *backend) rotateRootCredential(ctx context.Context, storage logical.Storage, key string, cfg *Config) (*logical.Response, error) {
+	if err := b.resolvePendingRootCredential(ctx, storage, key, cfg); err != nil {
+		return nil, err
+	}
+
+	identityClient, err := client(ctx, cfg, &RoleSet{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	userID, err := authenticatedUserID(identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.UsesApplicationCredential() {
+		return b.rotateRootApplicationCredential(ctx, storage, key, cfg, identityClient, userID)
+	}
+	return b.rotateRootPassword(ctx, storage, key, cfg, identityClient, userID)
+}
+
+// rotateRootPassword changes the password of the configured user. The new
+// password is stored as pending before Keystone is called, so that it is
+// never lost if storing the rotated config fails afterwards.
+func (b *backend) rotateRootPassword(ctx context.Context, storage logical.Storage, key string, cfg *Config, identityClient *gophercloud.ServiceClient, userID string) (*logical.Response, error) {
+	if cfg.Password == "" {
+		return logical.ErrorResponse("no password is configured to rotate"), nil
+	}
+
+	password, err := base62.Random(rootPasswordLength)
+	if err != nil {
+		return nil, fmt.Errorf("error generating password: %w", err)
+	}
+
+	cfg.PendingPassword = password
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		return nil, fmt.Errorf("error storing pending password: %w", err)
+	}
+
+	if err := users.ChangePassword(ctx, identityClient, userID, users.ChangePasswordOpts{
+		OriginalPassword: cfg.Password,
+		Password:         password,
+	}).ExtractErr(); err != nil {
+		// The pending password is kept in case the change went through
+		// regardless; the next rotation finds out.
+		return nil, fmt.Errorf("error changing password: %w", err)
+	}
+
+	cfg.Password = password
+	cfg.PendingPassword = ""
+	cfg.rotated()
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		b.Logger().Error("root password was changed in Keystone but is only stored as pending", "user_id", userID, "error", err)
+		return nil, fmt.Errorf("password was changed but could not be stored: %w", err)
+	}
+	b.resetClients()
+
+	return nil, nil
+}
+
+// rotateRootApplicationCredential replaces the configured application
+// credential with one that has the same roles, access rules and expiry. Its
+// name and secret are stored as pending before it is created, and the
+// previous credential is only deleted once the replacement is stored.
+func (b *backend) rotateRootApplicationCredential(ctx context.Context, storage logical.Storage, key string, cfg *Config, identityClient *gophercloud.ServiceClient, userID string) (*logical.Response, error) {
+	oldID, err := authenticatedApplicationCredentialID(identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := applicationcredentials.Get(ctx, identityClient, userID, oldID).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving application credential: %w", err)
+	}
+
+	secret, err := base62.Random(rootPasswordLength)
+	if err != nil {
+		return nil, fmt.Errorf("error generating secret: %w", err)
+	}
+	pending := &pendingApplicationCredential{
+		Name:   fmt.Sprintf("vault-root-%d", time.Now().UnixMilli()),
+		Secret: secret,
+	}
+
+	cfg.PendingApplicationCredential = pending
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		return nil, fmt.Errorf("error storing pending application credential: %w", err)
+	}
+
+	var expiresAt *time.Time
+	if !old.ExpiresAt.IsZero() {
+		expiresAt = &old.ExpiresAt
+	}
+	credential, err := applicationcredentials.Create(ctx, identityClient, userID, applicationcredentials.CreateOpts{
+		Name:         pending.Name,
+		Description:  fmt.Sprintf("Rotated by Vault at %s", time.Now().Format(time.RFC3339)),
+		Secret:       pending.Secret,
+		Unrestricted: old.Unrestricted,
+		Roles:        old.Roles,
+		AccessRules:  old.AccessRules,
+		ExpiresAt:    expiresAt,
+	}).Extract()
+	if err != nil {
+		return nil, fmt.Errorf("error creating application credential: %w", err)
+	}
+
+	if err := b.adoptRootApplicationCredential(ctx, storage, key, cfg, credential.ID); err != nil {
+		b.Logger().Error("root application credential was created in Keystone but is only stored as pending", "id", credential.ID, "error", err)
+		return nil, fmt.Errorf("application credential was created but could not be stored: %w", err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"application_credential_id": credential.ID,
+		},
+	}
+	if err := b.deleteRootApplicationCredential(ctx, cfg, userID, oldID); err != nil {
+		resp.AddWarning(fmt.Sprintf("previous application credential %q could not be deleted: %s", oldID, err))
+	}
+
+	return resp, nil
+}
+
+// adoptRootApplicationCredential switches cfg to its pending application
+// credential, which Keystone created with the given ID.
+func (b *backend) adoptRootApplicationCredential(ctx context.Context, storage logical.Storage, key string, cfg *Config, id string) error {
+	cfg.ApplicationCredentialID = id
+	cfg.ApplicationCredentialName = ""
+	cfg.ApplicationCredentialSecret = cfg.PendingApplicationCredential.Secret
+	cfg.PendingApplicationCredential = nil
+	cfg.rotated()
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		return err
+	}
+	b.resetClients()
+	return nil
+}
+
+// deleteRootApplicationCredential deletes a previous root application
+// credential with the current one, since deleting an application credential
+// also revokes the tokens it issued.
+func (b *backend) deleteRootApplicationCredential(ctx context.Context, cfg *Config, userID, id string) error {
+	newClient, err := client(ctx, cfg, &RoleSet{})
+	if err == nil {
+		err = applicationcredentials.Delete(ctx, newClient, userID, id).ExtractErr()
+	}
+	if err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		b.Logger().Warn("failed to delete previous root application credential", "id", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+// resolvePendingRootCredential finishes a rotation that was interrupted
+// after its new secret was stored as pending. The pending secret replaces
+// the stored one if Keystone accepted the change and is dropped otherwise.
+// The caller must hold rotationLock.
+func (b *backend) resolvePendingRootCredential(ctx context.Context, storage logical.Storage, key string, cfg *Config) error {
+	switch {
+	case cfg.PendingPassword != "":
+		candidate := *cfg
+		candidate.Password = cfg.PendingPassword
+		candidate.PendingPassword = ""
+
+		_, err := client(ctx, &candidate, &RoleSet{})
+		switch {
+		case err == nil:
+			b.Logger().Info("completing interrupted root password rotation", "config", key)
+			candidate.rotated()
+			*cfg = candidate
+		case gophercloud.ResponseCodeIs(err, http.StatusUnauthorized):
+			cfg.PendingPassword = ""
+		default:
+			return fmt.Errorf("error checking pending password: %w", err)
+		}
+
+	case cfg.PendingApplicationCredential != nil:
+		identityClient, err := client(ctx, cfg, &RoleSet{})
+		if err != nil {
+			return fmt.Errorf("error creating identity client: %w", err)
+		}
+		userID, err := authenticatedUserID(identityClient)
+		if err != nil {
+			return err
+		}
+		oldID, err := authenticatedApplicationCredentialID(identityClient)
+		if err != nil {
+			return err
+		}
+
+		pages, err := applicationcredentials.List(identityClient, userID, applicationcredentials.ListOpts{
+			Name: cfg.PendingApplicationCredential.Name,
+		}).AllPages(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing application credentials: %w", err)
+		}
+		found, err := applicationcredentials.ExtractApplicationCredentials(pages)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			cfg.PendingApplicationCredential = nil
+			break
+		}
+
+		b.Logger().Info("completing interrupted root application credential rotation", "config", key)
+		if err := b.adoptRootApplicationCredential(ctx, storage, key, cfg, found[0].ID); err != nil {
+			return fmt.Errorf("error storing application credential: %w", err)
+		}
+		_ = b.deleteRootApplicationCredential(ctx, cfg, userID, oldID)
+		return nil
+
+	default:
+		return nil
+	}
+
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		return fmt.Errorf("error storing access config: %w", err)
+	}
+	b.resetClients()
+	return nil
+}
+
+// rotateDueRootCredentials rotates the root credential of config/auth and
+// every config/cloud entry whose automatic rotation is due.
+func (b *backend) rotateDueRootCredentials(ctx context.Context, storage logical.Storage) error {
+	clouds, err := storage.List(ctx, configCloudPrefix)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{configAccessKey}
+	for _, cloud := range clouds {
+		keys = append(keys, configCloudPrefix+cloud)
+	}
+
+	var errs error
+	for _, key := range keys {
+		if err := b.rotateRootCredentialIfDue(ctx, storage, key); err != nil {
+			b.Logger().Error("automatic root credential rotation failed", "config", key, "error", err)
+			errs = errors.Join(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+
+	return errs
+}
+
+func (b *backend) rotateRootCredentialIfDue(ctx context.Context, storage logical.Storage, key string) error {
+	b.rotationLock.Lock()
+	defer b.rotationLock.Unlock()
+
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	cfg := &Config{}
+	if err := entry.DecodeJSON(cfg); err != nil {
+		return err
+	}
+
+	// A failed rotation is retried once its backoff has passed, not on
+	// every tick.
+	if cfg.RotationFailures > 0 && time.Now().Before(cfg.NextRotation()) {
+		return nil
+	}
+
+	if err := b.resolvePendingRootCredential(ctx, storage, key, cfg); err != nil {
+		return b.recordRootRotationFailure(ctx, storage, key, err)
+	}
+
+	next := cfg.NextRotation()
+	if next.IsZero() || time.Now().Before(next) {
+		return nil
+	}
+
+	resp, err := b.rotateRootCredential(ctx, storage, key, cfg)
+	if err == nil && resp != nil && resp.IsError() {
+		err = resp.Error()
+	}
+	if err != nil {
+		return b.recordRootRotationFailure(ctx, storage, key, err)
+	}
+
+	b.Logger().Info("rotated root credential", "config", key)
+	return nil
+}
+
+// recordRootRotationFailure stores that the automatic rotation of the config
+// under key failed with rotationErr, which it returns, so that the next
+// attempt backs off. The config is read again since the failed rotation may
+// have stored a pending secret.
+func (b *backend) recordRootRotationFailure(ctx context.Context, storage logical.Storage, key string, rotationErr error) error {
+	entry, err := storage.Get(ctx, key)
+	if err != nil || entry == nil {
+		return errors.Join(rotationErr, err)
+	}
+	cfg := &Config{}
+	if err := entry.DecodeJSON(cfg); err != nil {
+		return errors.Join(rotationErr, err)
+	}
+
+	cfg.RotationFailures++
+	cfg.LastRotationFailure = time.Now()
+	cfg.LastRotationError = rotationErr.Error()
+	if err := storeConfig(ctx, storage, key, cfg); err != nil {
+		return errors.Join(rotationErr, fmt.Errorf("error recording rotation failure: %w", err))
+	}
+	return rotationErr
+}
+
+// authenticatedApplicationCredentialID returns the ID of the application
+// credential the identity client authenticated with.
+func authenticatedApplicationCredentialID(identityClient *gophercloud.ServiceClient) (string, error) {
+	result, err := authResult(identityClient)
+	if err != nil {
+		return "", err
+	}
+
+	var s struct {
+		ApplicationCredential struct {
+			ID string `json:"id"`
+		} `json:"application_credential"`
+	}
+	if err := result.ExtractInto(&s); err != nil {
+		return "", fmt.Errorf("extract application credential from token: %w", err)
+	}
+	if s.ApplicationCredential.ID == "" {
+		return "", errors.New("token was not issued for an application credential")
+	}
+
+	return s.ApplicationCredential.ID, nil
+}
+
+var pathConfigRotateRootHelpSyn = "Rotate the credential of the configured OpenStack user"
+
+var pathConfigRotateRootHelpDesc = `
+Replaces the secret stored in config/auth, or in config/cloud/<name> for
+config/cloud/<name>/rotate-root, so that only Vault knows it. With
+password authentication the user's Keystone password is changed to a generated
+value. With application credential authentication a replacement application
+credential is created and the previous one is deleted; this requires the
+configured application credential to be unrestricted.
+
+Setting rotation_period or rotation_schedule on config/auth or config/cloud
+rotates the credential automatically.
+`
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -18,6 +19,20 @@ func pathCreateCreds(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the role set",
 			},
+			"trustee_user_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the user to delegate to, for rolesets issuing trusts",
+			},
+			"format": {
+				Type:        framework.TypeString,
+				Description: "Format to return the credentials in: json (default), clouds_yaml, openrc or env",
+				Default:     credsFormatJSON,
+			},
+			"cacert_path": {
+				Type:        framework.TypeString,
+				Description: "Path the CA certificate is referenced by in clouds_yaml, openrc and env output",
+				Default:     defaultCACertPath,
+			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathTokenRead,
@@ -46,7 +61,7 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
 	}
 
-	cfg, err := b.readConfigAccess(ctx, req.Storage)
+	cfg, err := b.configForRole(ctx, req.Storage, role)
 	if err != nil {
 		return nil, fmt.Errorf("error reading access config: %w", err)
 	}
@@ -54,43 +69,197 @@ func (b *backend) pathTokenRead(ctx context.Context, req *logical.Request, d *fr
 		return logical.ErrorResponse("access config not found"), nil
 	}
 
-	// Validate: app credentials cannot be used with project-scoped rolesets
-	if cfg.UsesApplicationCredential() && role.HasProject() {
+	format := d.Get("format").(string)
+	if !credsFormats[format] {
+		return logical.ErrorResponse(fmt.Sprintf("invalid format %q", format)), nil
+	}
+	if format != credsFormatJSON && !formattedCredentialTypes[role.credentialType()] {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"format %q is not supported for %s credentials", format, role.credentialType(),
+		)), nil
+	}
+
+	// Validate: app credentials cannot be used with scoped rolesets
+	if cfg.UsesApplicationCredential() && role.HasScope() {
 		return logical.ErrorResponse(
-			"cannot use application credential authentication with project-scoped rolesets; " +
+			"cannot use application credential authentication with scoped rolesets; " +
 				"application credentials are bound to their original project. " +
 				"Use username/password authentication for multi-project support, " +
 				"or remove project fields from the roleset",
 		), nil
 	}
 
-	identityClient, err := client(ctx, cfg, role)
+	identityClient, err := b.cachedClient(ctx, cfg, role)
 	if err != nil {
 		return nil, fmt.Errorf("error creating identity client: %w", err)
 	}
 
-	// Create application credential
-	tokenName := fmt.Sprintf("vault-%s-%s-%d", name, req.DisplayName, time.Now().UnixMilli())
-	expireTime := time.Now().Add(leaseConfig.TTL)
-	credential, err := applicationcredentials.Create(ctx, identityClient, cfg.UserID, applicationcredentials.CreateOpts{
-		Name:        tokenName,
-		Description: fmt.Sprintf("Created by Vault at %s", time.Now().Format(time.RFC3339)),
-		Roles:       role.Roles,
-		ExpiresAt:   &expireTime,
+	ttl, maxTTL := b.leaseTTLs(role, leaseConfig)
+	is := &issuance{
+		name:           name,
+		role:           role,
+		cfg:            cfg,
+		identityClient: identityClient,
+		ttl:            ttl,
+		maxTTL:         maxTTL,
+		trusteeUserID:  d.Get("trustee_user_id").(string),
+	}
+
+	resp, err := b.issueCountedLease(ctx, req, name, role, func() (*logical.Response, error) {
+		switch role.credentialType() {
+		case credentialTypeDynamicUser:
+			return b.issueDynamicUser(ctx, req, is)
+		case credentialTypeEC2:
+			return b.issueEC2Credential(ctx, req, is)
+		case credentialTypeTrust:
+			return b.issueTrust(ctx, req, is)
+		case credentialTypeEphemeralProject:
+			return b.issueEphemeralProject(ctx, req, is)
+		default:
+			return b.issueApplicationCredential(ctx, req, is)
+		}
+	})
+	if err != nil || resp == nil || resp.Secret == nil {
+		return resp, err
+	}
+
+	if err := formatCredentials(format, name, cfg, resp.Data, d.Get("cacert_path").(string)); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// issuance carries what every credential type needs to issue a secret.
+type issuance struct {
+	name           string
+	role           *RoleSet
+	cfg            *Config
+	identityClient *gophercloud.ServiceClient
+	ttl            time.Duration
+	maxTTL         time.Duration
+
+	// trusteeUserID is supplied by the caller for rolesets issuing trusts.
+	trusteeUserID string
+}
+
+func (b *backend) issueApplicationCredential(ctx context.Context, req *logical.Request, is *issuance) (*logical.Response, error) {
+	if scopeType := is.role.scopeType(); scopeType == scopeTypeDomain || scopeType == scopeTypeSystem {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"application credentials cannot be %s-scoped; read token/%s instead", scopeType, is.name,
+		)), nil
+	}
+
+	if is.role.PoolSize > 0 {
+		pooled, walID, err := b.takePooledCredential(ctx, req.Storage, is.name, is.role, time.Now().Add(is.maxTTL/2))
+		// Whether or not one was available, the pool is topped up in the
+		// background.
+		b.refillPoolAsync(req.Storage, is.name)
+		if err != nil {
+			return nil, err
+		}
+		if pooled != nil {
+			resp := b.applicationCredentialResponse(is, pooled.ID, pooled.Secret, pooled.UserID, pooled.ExpiresAt)
+			// Pooled credentials have already used up part of their
+			// lifetime in Keystone.
+			resp.Secret.TTL = min(resp.Secret.TTL, time.Until(pooled.ExpiresAt))
+			resp.Secret.MaxTTL = min(resp.Secret.MaxTTL, time.Until(pooled.ExpiresAt))
+
+			if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+				return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+			}
+			return resp, nil
+		}
+	}
+
+	tokenName := fmt.Sprintf("vault-%s-%s-%d", is.name, req.DisplayName, time.Now().UnixMilli())
+	credential, userID, walID, err := b.createApplicationCredential(ctx, req.Storage, is, tokenName)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := b.applicationCredentialResponse(is, credential.ID, credential.Secret, userID, credential.ExpiresAt)
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+// createApplicationCredential creates an application credential for the
+// roleset and tracks it for tidy. The WAL entry guarding the creation is left
+// for the caller to delete once the credential has been handed on.
+func (b *backend) createApplicationCredential(ctx context.Context, storage logical.Storage, is *issuance, name string) (*applicationcredentials.ApplicationCredential, string, string, error) {
+	userID, err := b.userID(is.cfg, is.identityClient)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// The Keystone expiry is set to the max TTL so the lease can be renewed up
+	// to that point; Vault revokes the credential earlier if it isn't renewed.
+	// Credentials issued without a max TTL don't expire.
+	var expireTime time.Time
+	var expiresAt *time.Time
+	if is.maxTTL > 0 {
+		expireTime = time.Now().Add(is.maxTTL)
+		expiresAt = &expireTime
+	}
+
+	description, err := b.issuedCredentialDescription(ctx, storage)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Record the credential before creating it so that it is rolled back if
+	// the lease never makes it back to Vault.
+	walID, err := framework.PutWAL(ctx, storage, walTypeApplicationCredential, &walApplicationCredential{
+		RoleSet: is.name,
+		Cloud:   is.role.Cloud,
+		UserID:  userID,
+		Name:    name,
+	})
+	if err != nil {
+		return nil, "", "", fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	credential, err := applicationcredentials.Create(ctx, is.identityClient, userID, applicationcredentials.CreateOpts{
+		Name:        name,
+		Description: description,
+		Roles:       is.role.Roles,
+		AccessRules: is.role.AccessRules,
+		ExpiresAt:   expiresAt,
 	}).Extract()
 	if err != nil {
 		b.Logger().Warn("Create applicationcredential", "error", err)
-		return nil, err
+		return nil, "", "", err
 	}
-	// Use the helper to create the secret
+	credential.ExpiresAt = expireTime
+
+	if err := b.putIssuedCredential(ctx, storage, credential.ID, &issuedCredential{
+		RoleSet:   is.name,
+		Cloud:     is.role.Cloud,
+		ExpiresAt: expireTime,
+	}); err != nil {
+		return nil, "", "", fmt.Errorf("error storing issued credential: %w", err)
+	}
+
+	return credential, userID, walID, nil
+}
+
+// applicationCredentialResponse returns the lease for an application
+// credential.
+func (b *backend) applicationCredentialResponse(is *issuance, id, secret, userID string, expiresAt time.Time) *logical.Response {
 	resp := b.Secret(SecretTokenType).Response(map[string]interface{}{
-		"application_credential_id":     credential.ID,
-		"application_credential_secret": credential.Secret,
+		"application_credential_id":     id,
+		"application_credential_secret": secret,
 	}, map[string]interface{}{
-		"application_credential_id": credential.ID,
-		"roleset":                   name,
+		"application_credential_id": id,
+		"user_id":                   userID,
+		"roleset":                   is.name,
+		"cloud":                     is.role.Cloud,
+		"expires_at":                expiresAt.Format(time.RFC3339),
 	})
-	resp.Secret.TTL = leaseConfig.TTL
-
-	return resp, nil
+	resp.Secret.TTL = is.ttl
+	resp.Secret.MaxTTL = is.maxTTL
+	return resp
 }
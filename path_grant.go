@@ -0,0 +1,425 @@
+package openstack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretRoleGrantType = "role_grant"
+
+	roleGrantPrefix = "role_grant/"
+)
+
+func pathGrant(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "grant/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role set",
+			},
+			"user_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the existing user to grant the roleset's roles to",
+			},
+			"group_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the existing group to grant the roleset's roles to",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathGrantWrite,
+		},
+		HelpSynopsis:    pathGrantHelpSyn,
+		HelpDescription: pathGrantHelpDesc,
+	}
+}
+
+func secretRoleGrant(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretRoleGrantType,
+		Fields: map[string]*framework.FieldSchema{
+			"granted_role_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IDs of the roles assigned for the lease",
+			},
+		},
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretRoleGrantRevoke),
+	}
+}
+
+func (b *backend) pathGrantWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	userID := d.Get("user_id").(string)
+	groupID := d.Get("group_id").(string)
+
+	if (userID == "") == (groupID == "") {
+		return logical.ErrorResponse("exactly one of user_id or group_id is required"), nil
+	}
+
+	leaseConfig, err := b.LeaseConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
+	}
+
+	role, err := b.Role(ctx, req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %w", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+	if len(role.Roles) == 0 {
+		return logical.ErrorResponse(fmt.Sprintf("role %q has no roles to grant", name)), nil
+	}
+	if userID != "" && !slices.Contains(role.AllowedGranteeUserIDs, userID) {
+		return logical.ErrorResponse(fmt.Sprintf("user_id %q is not in the roleset's allowed_grantee_user_ids", userID)), nil
+	}
+	if groupID != "" && !slices.Contains(role.AllowedGranteeGroupIDs, groupID) {
+		return logical.ErrorResponse(fmt.Sprintf("group_id %q is not in the roleset's allowed_grantee_group_ids", groupID)), nil
+	}
+
+	cfg, err := b.configForRole(ctx, req.Storage, role)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("access config not found"), nil
+	}
+
+	if cfg.UsesApplicationCredential() && role.HasScope() {
+		return logical.ErrorResponse(
+			"cannot use application credential authentication with scoped rolesets; " +
+				"application credentials are bound to their original project",
+		), nil
+	}
+
+	return b.issueCountedLease(ctx, req, name, role, func() (*logical.Response, error) {
+		return b.issueRoleGrant(ctx, req, name, cfg, role, leaseConfig, userID, groupID)
+	})
+}
+
+// issueRoleGrant assigns the roleset's roles to the user or group on the
+// roleset's project and returns the grant as a lease.
+func (b *backend) issueRoleGrant(ctx context.Context, req *logical.Request, name string, cfg *Config, role *RoleSet, leaseConfig *configLease, userID, groupID string) (*logical.Response, error) {
+	identityClient, err := b.cachedClient(ctx, cfg, role)
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	projectID, err := scopedProjectID(identityClient)
+	if err != nil {
+		return logical.ErrorResponse("grants require a project-scoped roleset: %s", err), nil
+	}
+
+	roleIDs, err := resolveRoleIDs(ctx, identityClient, role.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	// Roles that are already assigned are left alone so that revoking the
+	// lease doesn't take away access that Vault never granted.
+	pages, err := roles.ListAssignmentsOnResource(identityClient, roles.ListAssignmentsOnResourceOpts{
+		UserID:    userID,
+		GroupID:   groupID,
+		ProjectID: projectID,
+	}).AllPages(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing role assignments: %w", err)
+	}
+	assigned, err := roles.ExtractRoles(pages)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(assigned))
+	for _, r := range assigned {
+		existing[r.ID] = true
+	}
+
+	ttl, maxTTL := b.leaseTTLs(role, leaseConfig)
+
+	// Role assignments never expire on their own; the expiry only bounds how
+	// long the lease can be renewed for.
+	expireTime := time.Now().Add(maxTTL)
+
+	grantID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	assignment := roleAssignment{
+		cloud:     role.Cloud,
+		userID:    userID,
+		groupID:   groupID,
+		projectID: projectID,
+	}
+
+	walID, err := framework.PutWAL(ctx, req.Storage, walTypeRoleGrant, &walRoleGrant{
+		RoleSet:   name,
+		Cloud:     role.Cloud,
+		UserID:    userID,
+		GroupID:   groupID,
+		ProjectID: projectID,
+		GrantID:   grantID,
+		RoleIDs:   roleIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	grantRoleIDs, err := b.holdRoleAssignments(ctx, req.Storage, identityClient, assignment, grantID, roleIDs, existing)
+	if err != nil {
+		// Leave the WAL entry behind if the held roles can't be released
+		// right away so that the rollback retries.
+		if releaseErr := b.releaseRoleAssignments(ctx, req.Storage, identityClient, assignment, grantID, grantRoleIDs); releaseErr == nil {
+			if walErr := framework.DeleteWAL(ctx, req.Storage, walID); walErr != nil {
+				b.Logger().Warn("failed to delete WAL entry", "error", walErr)
+			}
+		}
+		return nil, err
+	}
+
+	data := map[string]interface{}{
+		"project_id":       projectID,
+		"role_ids":         roleIDs,
+		"granted_role_ids": grantRoleIDs,
+	}
+	internal := map[string]interface{}{
+		"roleset":          name,
+		"cloud":            role.Cloud,
+		"project_id":       projectID,
+		"granted_role_ids": strings.Join(grantRoleIDs, ","),
+		"grant_id":         grantID,
+		"expires_at":       expireTime.Format(time.RFC3339),
+	}
+	if userID != "" {
+		data["user_id"] = userID
+		internal["user_id"] = userID
+	} else {
+		data["group_id"] = groupID
+		internal["group_id"] = groupID
+	}
+
+	resp := b.Secret(SecretRoleGrantType).Response(data, internal)
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+
+	if len(grantRoleIDs) == 0 {
+		resp.AddWarning("all of the roleset's roles were already assigned; revoking the lease leaves them in place")
+	}
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (b *backend) secretRoleGrantRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rawRoleIDs, err := leaseInternalString(req, "granted_role_ids")
+	if err != nil {
+		return nil, err
+	}
+	if rawRoleIDs == "" {
+		return nil, nil
+	}
+
+	projectID, err := leaseInternalString(req, "project_id")
+	if err != nil {
+		return nil, err
+	}
+	grantID, err := leaseInternalString(req, "grant_id")
+	if err != nil {
+		return nil, err
+	}
+	cloud, _ := leaseInternalString(req, "cloud")
+	userID, _ := leaseInternalString(req, "user_id")
+	groupID, _ := leaseInternalString(req, "group_id")
+
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	assignment := roleAssignment{
+		cloud:     cloud,
+		userID:    userID,
+		groupID:   groupID,
+		projectID: projectID,
+	}
+	if err := b.releaseRoleAssignments(ctx, req.Storage, identityClient, assignment, grantID, strings.Split(rawRoleIDs, ",")); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// roleAssignment identifies the assignment of a role to a user or group on a
+// project of a cloud.
+type roleAssignment struct {
+	cloud     string
+	userID    string
+	groupID   string
+	projectID string
+	roleID    string
+}
+
+func (a roleAssignment) storageKey() string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{a.cloud, a.userID, a.groupID, a.projectID, a.roleID}, "\x00")))
+	return roleGrantPrefix + hex.EncodeToString(sum[:])
+}
+
+// roleGrantHolders lists the grants holding a role assignment that Vault
+// made, so that it is only removed once the last of their leases is revoked.
+type roleGrantHolders struct {
+	GrantIDs []string `json:"grant_ids"`
+}
+
+func getRoleGrantHolders(ctx context.Context, storage logical.Storage, assignment roleAssignment) (*roleGrantHolders, error) {
+	entry, err := storage.Get(ctx, assignment.storageKey())
+	if err != nil {
+		return nil, err
+	}
+
+	holders := &roleGrantHolders{}
+	if entry == nil {
+		return holders, nil
+	}
+	if err := entry.DecodeJSON(holders); err != nil {
+		return nil, fmt.Errorf("error reading role grant holders: %w", err)
+	}
+	return holders, nil
+}
+
+func putRoleGrantHolders(ctx context.Context, storage logical.Storage, assignment roleAssignment, holders *roleGrantHolders) error {
+	if len(holders.GrantIDs) == 0 {
+		return storage.Delete(ctx, assignment.storageKey())
+	}
+
+	entry, err := logical.StorageEntryJSON(assignment.storageKey(), holders)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+// holdRoleAssignments adds grantID to the holders of the assignments of
+// roleIDs and assigns the roles that aren't assigned yet. Roles that were
+// assigned outside of Vault are skipped. It returns the roles that are held,
+// even on error.
+func (b *backend) holdRoleAssignments(ctx context.Context, storage logical.Storage, identityClient *gophercloud.ServiceClient, assignment roleAssignment, grantID string, roleIDs []string, existing map[string]bool) ([]string, error) {
+	b.grantLock.Lock()
+	defer b.grantLock.Unlock()
+
+	var held []string
+	for _, roleID := range roleIDs {
+		assignment.roleID = roleID
+
+		holders, err := getRoleGrantHolders(ctx, storage, assignment)
+		if err != nil {
+			return held, err
+		}
+		if len(holders.GrantIDs) == 0 && existing[roleID] {
+			continue
+		}
+
+		// The holder is recorded before the role is assigned so that the
+		// rollback releases it if the lease never makes it back to Vault.
+		holders.GrantIDs = append(holders.GrantIDs, grantID)
+		if err := putRoleGrantHolders(ctx, storage, assignment, holders); err != nil {
+			return held, err
+		}
+		held = append(held, roleID)
+
+		if existing[roleID] {
+			continue
+		}
+		if err := roles.Assign(ctx, identityClient, roleID, roles.AssignOpts{
+			UserID:    assignment.userID,
+			GroupID:   assignment.groupID,
+			ProjectID: assignment.projectID,
+		}).ExtractErr(); err != nil {
+			return held, fmt.Errorf("error assigning role %q: %w", roleID, err)
+		}
+	}
+
+	return held, nil
+}
+
+// releaseRoleAssignments removes grantID from the holders of the assignments
+// of roleIDs and unassigns the roles that are no longer held by any grant.
+func (b *backend) releaseRoleAssignments(ctx context.Context, storage logical.Storage, identityClient *gophercloud.ServiceClient, assignment roleAssignment, grantID string, roleIDs []string) error {
+	b.grantLock.Lock()
+	defer b.grantLock.Unlock()
+
+	var errs error
+	for _, roleID := range roleIDs {
+		assignment.roleID = roleID
+
+		holders, err := getRoleGrantHolders(ctx, storage, assignment)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		idx := slices.Index(holders.GrantIDs, grantID)
+		if idx < 0 {
+			continue
+		}
+		holders.GrantIDs = slices.Delete(holders.GrantIDs, idx, idx+1)
+
+		if len(holders.GrantIDs) == 0 {
+			if err := unassignRoles(ctx, identityClient, assignment.userID, assignment.groupID, assignment.projectID, []string{roleID}); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+		}
+		if err := putRoleGrantHolders(ctx, storage, assignment, holders); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	return errs
+}
+
+// unassignRoles removes the given role assignments from a user or group on a
+// project. Assignments that are already gone are skipped.
+func unassignRoles(ctx context.Context, identityClient *gophercloud.ServiceClient, userID, groupID, projectID string, roleIDs []string) error {
+	var errs error
+	for _, roleID := range roleIDs {
+		if err := roles.Unassign(ctx, identityClient, roleID, roles.UnassignOpts{
+			UserID:    userID,
+			GroupID:   groupID,
+			ProjectID: projectID,
+		}).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			errs = errors.Join(errs, fmt.Errorf("error unassigning role %q: %w", roleID, err))
+		}
+	}
+	return errs
+}
+
+var pathGrantHelpSyn = "Temporarily assign a roleset's roles to an existing user or group"
+
+var pathGrantHelpDesc = `
+Assigns the roleset's roles on the roleset's project to the given user_id or
+group_id for the duration of the lease. The user or group must be listed in
+the roleset's allowed_grantee_user_ids or allowed_grantee_group_ids. Roles the user or group already holds
+are left untouched; the ones Vault assigned are removed once every lease
+holding them has been revoked.
+`
@@ -0,0 +1,214 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestGrant_Validation(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/no-roles",
+		Data: map[string]interface{}{
+			"project_id": "project123",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/operator",
+		Data: map[string]interface{}{
+			"project_id":                "project123",
+			"roles":                     `[{"name": "admin"}]`,
+			"allowed_grantee_user_ids":  "user123",
+			"allowed_grantee_group_ids": "group123",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		data map[string]interface{}
+	}{
+		{
+			name: "neither user nor group",
+			path: "grant/operator",
+			data: map[string]interface{}{},
+		},
+		{
+			name: "both user and group",
+			path: "grant/operator",
+			data: map[string]interface{}{
+				"user_id":  "user123",
+				"group_id": "group123",
+			},
+		},
+		{
+			name: "unknown roleset",
+			path: "grant/missing",
+			data: map[string]interface{}{
+				"user_id": "user123",
+			},
+		},
+		{
+			name: "roleset without roles",
+			path: "grant/no-roles",
+			data: map[string]interface{}{
+				"user_id": "user123",
+			},
+		},
+		{
+			name: "user not allowed",
+			path: "grant/operator",
+			data: map[string]interface{}{
+				"user_id": "user456",
+			},
+		},
+		{
+			name: "group not allowed",
+			path: "grant/operator",
+			data: map[string]interface{}{
+				"group_id": "group456",
+			},
+		},
+		{
+			name: "no access config",
+			path: "grant/operator",
+			data: map[string]interface{}{
+				"group_id": "group123",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      tc.path,
+				Data:      tc.data,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatalf("expected error response, got %#v", resp)
+			}
+		})
+	}
+}
+
+func TestGrant_SharedAssignments(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatal(resp.Error())
+		}
+		return resp
+	}
+	revoke := func(resp *logical.Response) {
+		t.Helper()
+		if _, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   reqStorage,
+			Secret:    resp.Secret,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assigned := func(role string) bool {
+		_, ok := ks.assignments.Load("project123/users/user456/" + role)
+		return ok
+	}
+
+	request(logical.UpdateOperation, configAccessKey, map[string]interface{}{
+		"auth_url":          ks.URL + "/v3",
+		"username":          "svc",
+		"user_domain_id":    "default",
+		"password":          "secret",
+		"verify_connection": false,
+	})
+	request(logical.UpdateOperation, "roleset/operator", map[string]interface{}{
+		"project_id":               "project123",
+		"roles":                    "member,admin",
+		"allowed_grantee_user_ids": "user456",
+		"verify_connection":        false,
+	})
+
+	// The admin role was assigned outside of Vault
+	ks.assignments.Store("project123/users/user456/role-admin", true)
+
+	first := request(logical.UpdateOperation, "grant/operator", map[string]interface{}{"user_id": "user456"})
+	second := request(logical.UpdateOperation, "grant/operator", map[string]interface{}{"user_id": "user456"})
+	if !assigned("role-member") {
+		t.Fatal("expected the member role to be assigned")
+	}
+
+	// The role stays assigned while another lease holds it
+	revoke(first)
+	if !assigned("role-member") {
+		t.Fatal("expected the member role to stay assigned for the second lease")
+	}
+
+	revoke(second)
+	if assigned("role-member") {
+		t.Error("expected the member role to be removed with the last lease")
+	}
+	if !assigned("role-admin") {
+		t.Error("expected the role assigned outside of Vault to be left alone")
+	}
+
+	holders, err := reqStorage.List(context.Background(), roleGrantPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holders) != 0 {
+		t.Errorf("expected no role grant holders to be left, got %d", len(holders))
+	}
+}
+
+func TestWALRollback_RoleGrantWithoutRoles(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	data := map[string]interface{}{
+		"roleset":    "operator",
+		"user_id":    "user123",
+		"project_id": "project123",
+		"role_ids":   []interface{}{},
+	}
+
+	err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeRoleGrant, data)
+	if err != nil {
+		t.Fatalf("expected entry without roles to be dropped, got: %v", err)
+	}
+}
@@ -0,0 +1,785 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	libraryPrefix        = "library/"
+	libraryAccountPrefix = "library-accounts/"
+)
+
+func pathListLibrary(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathLibraryList,
+		},
+	}
+}
+
+func pathLibrary(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the library set",
+			},
+			"user_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IDs of existing Keystone users whose passwords the library manages",
+			},
+			"cloud": {
+				Type:        framework.TypeString,
+				Description: "Name of the config/cloud entry the users live in; defaults to config/auth",
+			},
+			"roleset": {
+				Type:        framework.TypeString,
+				Description: "Roleset whose application credentials the library manages, instead of users",
+			},
+			"size": {
+				Type:        framework.TypeInt,
+				Description: "Number of application credentials in a roleset-backed library set",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Default check-out TTL, overriding config/lease",
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum check-out TTL, overriding config/lease",
+			},
+			"disable_check_in_enforcement": {
+				Type:        framework.TypeBool,
+				Description: "Allow accounts to be checked in by entities other than the one that checked them out",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathLibraryRead,
+			logical.CreateOperation: b.pathLibraryWrite,
+			logical.UpdateOperation: b.pathLibraryWrite,
+			logical.DeleteOperation: b.pathLibraryDelete,
+		},
+		ExistenceCheck:  b.libraryExistenceCheck,
+		HelpSynopsis:    pathLibraryHelpSyn,
+		HelpDescription: pathLibraryHelpDesc,
+	}
+}
+
+func pathLibraryCheckOut(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/check-out$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the library set",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "TTL of the check-out, capped by the set's max_ttl",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckOut,
+		},
+	}
+}
+
+func pathLibraryCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/check-in$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the library set",
+			},
+			"accounts": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Accounts to check in; defaults to those checked out by the caller",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckIn(true),
+		},
+	}
+}
+
+func pathLibraryManageCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + "manage/" + framework.GenericNameRegex("name") + "/check-in$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the library set",
+			},
+			"accounts": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Accounts to check in, regardless of who checked them out",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLibraryCheckIn(false),
+		},
+	}
+}
+
+func pathLibraryStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: libraryPrefix + framework.GenericNameRegex("name") + "/status$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the library set",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathLibraryStatus,
+		},
+	}
+}
+
+type librarySet struct {
+	UserIDs                   []string      `json:"user_ids,omitempty"`
+	Cloud                     string        `json:"cloud,omitempty"`
+	RoleSet                   string        `json:"roleset,omitempty"`
+	Size                      int           `json:"size,omitempty"`
+	TTL                       time.Duration `json:"ttl,omitempty"`
+	MaxTTL                    time.Duration `json:"max_ttl,omitempty"`
+	DisableCheckInEnforcement bool          `json:"disable_check_in_enforcement,omitempty"`
+}
+
+// accounts returns the names of the accounts in the set: user IDs, or
+// "<set>-<n>" for the application credentials of roleset-backed sets.
+func (s *librarySet) accounts(name string) []string {
+	if s.RoleSet == "" {
+		return s.UserIDs
+	}
+	accounts := make([]string, 0, s.Size)
+	for i := 1; i <= s.Size; i++ {
+		accounts = append(accounts, name+"-"+strconv.Itoa(i))
+	}
+	return accounts
+}
+
+// libraryAccount is a user or application credential in a library set along
+// with its current secret.
+type libraryAccount struct {
+	UserID                      string `json:"user_id"`
+	Username                    string `json:"username,omitempty"`
+	UserDomainID                string `json:"user_domain_id,omitempty"`
+	Password                    string `json:"password,omitempty"`
+	ApplicationCredentialID     string `json:"application_credential_id,omitempty"`
+	ApplicationCredentialSecret string `json:"application_credential_secret,omitempty"`
+
+	// PendingPassword holds the password a rotation is switching to until
+	// it has been set in Keystone.
+	PendingPassword string `json:"pending_password,omitempty"`
+
+	CheckOut *libraryCheckOut `json:"check_out,omitempty"`
+}
+
+type libraryCheckOut struct {
+	// ID ties the check-out to its lease, so that revoking a lease never
+	// checks in a later check-out of the same account.
+	ID           string    `json:"id"`
+	Borrower     string    `json:"borrower"`
+	CheckedOutAt time.Time `json:"checked_out_at"`
+}
+
+func (b *backend) libraryExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	set, err := b.librarySet(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return set != nil, nil
+}
+
+func (b *backend) librarySet(ctx context.Context, storage logical.Storage, name string) (*librarySet, error) {
+	if name == "" {
+		return nil, errors.New("invalid library set name")
+	}
+
+	entry, err := storage.Get(ctx, libraryPrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving library set: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	result := &librarySet{}
+	if err := entry.DecodeJSON(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *backend) libraryAccount(ctx context.Context, storage logical.Storage, set, account string) (*libraryAccount, error) {
+	entry, err := storage.Get(ctx, libraryAccountPrefix+set+"/"+account)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving library account: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	result := &libraryAccount{}
+	if err := entry.DecodeJSON(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func storeLibraryAccount(ctx context.Context, storage logical.Storage, set, name string, account *libraryAccount) error {
+	entry, err := logical.StorageEntryJSON(libraryAccountPrefix+set+"/"+name, account)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) pathLibraryList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, libraryPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathLibraryRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	set, err := b.librarySet(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"user_ids":                     set.UserIDs,
+			"cloud":                        set.Cloud,
+			"roleset":                      set.RoleSet,
+			"size":                         set.Size,
+			"ttl":                          int64(set.TTL.Seconds()),
+			"max_ttl":                      int64(set.MaxTTL.Seconds()),
+			"disable_check_in_enforcement": set.DisableCheckInEnforcement,
+		},
+	}, nil
+}
+
+func (b *backend) pathLibraryWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	set, err := b.librarySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	create := set == nil
+	if create {
+		set = &librarySet{}
+	}
+	previous := set.accounts(name)
+
+	if userIDs, ok := d.GetOk("user_ids"); ok {
+		set.UserIDs = userIDs.([]string)
+	}
+	if cloud, ok := d.GetOk("cloud"); ok {
+		if !create && cloud.(string) != set.Cloud {
+			return logical.ErrorResponse("cloud cannot be changed on an existing library set"), nil
+		}
+		set.Cloud = cloud.(string)
+	}
+	if roleset, ok := d.GetOk("roleset"); ok {
+		if !create && roleset.(string) != set.RoleSet {
+			return logical.ErrorResponse("roleset cannot be changed on an existing library set"), nil
+		}
+		set.RoleSet = roleset.(string)
+	}
+	if size, ok := d.GetOk("size"); ok {
+		set.Size = size.(int)
+	}
+	if ttl, ok := d.GetOk("ttl"); ok {
+		set.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := d.GetOk("max_ttl"); ok {
+		set.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if disable, ok := d.GetOk("disable_check_in_enforcement"); ok {
+		set.DisableCheckInEnforcement = disable.(bool)
+	}
+
+	switch {
+	case set.RoleSet == "" && len(set.UserIDs) == 0:
+		return logical.ErrorResponse("either user_ids or roleset is required"), nil
+	case set.RoleSet != "" && len(set.UserIDs) > 0:
+		return logical.ErrorResponse("user_ids and roleset are mutually exclusive"), nil
+	case set.RoleSet != "" && set.Size <= 0:
+		return logical.ErrorResponse("size must be positive for roleset-backed library sets"), nil
+	case set.RoleSet != "" && set.Cloud != "":
+		return logical.ErrorResponse("roleset-backed library sets use the roleset's cloud"), nil
+	case set.MaxTTL > 0 && set.TTL > set.MaxTTL:
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	accounts := set.accounts(name)
+	seen := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		if seen[account] {
+			return logical.ErrorResponse(fmt.Sprintf("user %q is listed more than once", account)), nil
+		}
+		seen[account] = true
+	}
+
+	// Accounts leaving the set must not be in use.
+	var removed []string
+	for _, account := range previous {
+		if slices.Contains(accounts, account) {
+			continue
+		}
+		existing, err := b.libraryAccount(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.CheckOut != nil {
+			return logical.ErrorResponse(fmt.Sprintf("account %q is checked out and can't be removed", account)), nil
+		}
+		removed = append(removed, account)
+	}
+
+	is, resp, err := b.libraryIssuance(ctx, req.Storage, set)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+
+	if set.RoleSet == "" {
+		rootUserID, err := authenticatedUserID(is.identityClient)
+		if err == nil && slices.Contains(set.UserIDs, rootUserID) {
+			return logical.ErrorResponse("the configured OpenStack user is managed with config/rotate-root"), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON(libraryPrefix+name, set)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	var errs error
+	for _, account := range removed {
+		errs = errors.Join(errs, b.removeLibraryAccount(ctx, req.Storage, is, name, account))
+	}
+
+	// New accounts have their secret rotated right away so that only Vault
+	// knows it.
+	for _, account := range accounts {
+		existing, err := b.libraryAccount(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			continue
+		}
+
+		if set.RoleSet == "" {
+			user, err := users.Get(ctx, is.identityClient, account).Extract()
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error retrieving user %q: %s", account, err)), nil
+			}
+			existing = &libraryAccount{UserID: user.ID, Username: user.Name, UserDomainID: user.DomainID}
+		} else {
+			existing = &libraryAccount{}
+		}
+
+		if err := b.rotateLibraryAccount(ctx, req.Storage, is, name, account, existing); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, errs
+}
+
+func (b *backend) pathLibraryDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	set, err := b.librarySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	accounts := set.accounts(name)
+	for _, account := range accounts {
+		existing, err := b.libraryAccount(ctx, req.Storage, name, account)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.CheckOut != nil {
+			return logical.ErrorResponse(fmt.Sprintf("account %q is checked out; check it in before deleting the library set", account)), nil
+		}
+	}
+
+	is, resp, err := b.libraryIssuance(ctx, req.Storage, set)
+	if err != nil || resp != nil {
+		return resp, err
+	}
+
+	for _, account := range accounts {
+		if err := b.removeLibraryAccount(ctx, req.Storage, is, name, account); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := req.Storage.Delete(ctx, libraryPrefix+name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathLibraryCheckOut(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	set, err := b.librarySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return logical.ErrorResponse(fmt.Sprintf("library set %q not found", name)), nil
+	}
+
+	leaseConfig, err := b.LeaseConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
+	}
+	ttl, maxTTL := b.leaseTTLs(&RoleSet{TTL: set.TTL, MaxTTL: set.MaxTTL}, leaseConfig)
+	if requested, ok := d.GetOk("ttl"); ok {
+		ttl = min(time.Duration(requested.(int))*time.Second, maxTTL)
+	}
+
+	for _, accountName := range set.accounts(name) {
+		account, err := b.libraryAccount(ctx, req.Storage, name, accountName)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil || account.CheckOut != nil {
+			continue
+		}
+
+		// The stored password may not be the one Keystone has if the last
+		// rotation didn't finish, so the rotation is completed first.
+		if account.PendingPassword != "" {
+			is, resp, err := b.libraryIssuance(ctx, req.Storage, set)
+			if err != nil || resp != nil {
+				return resp, err
+			}
+			if err := b.rotateLibraryAccount(ctx, req.Storage, is, name, accountName, account); err != nil {
+				return nil, err
+			}
+		}
+
+		checkOutID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		account.CheckOut = &libraryCheckOut{
+			ID:           checkOutID,
+			Borrower:     requesterID(req),
+			CheckedOutAt: time.Now(),
+		}
+		if err := storeLibraryAccount(ctx, req.Storage, name, accountName, account); err != nil {
+			return nil, err
+		}
+
+		data := map[string]interface{}{"account": accountName}
+		if set.RoleSet == "" {
+			data["user_id"] = account.UserID
+			data["username"] = account.Username
+			data["user_domain_id"] = account.UserDomainID
+			data["password"] = account.Password
+		} else {
+			data["application_credential_id"] = account.ApplicationCredentialID
+			data["application_credential_secret"] = account.ApplicationCredentialSecret
+		}
+
+		resp := b.Secret(SecretLibraryType).Response(data, map[string]interface{}{
+			"set":          name,
+			"account":      accountName,
+			"check_out_id": checkOutID,
+			"expires_at":   time.Now().Add(maxTTL).Format(time.RFC3339),
+		})
+		resp.Secret.TTL = ttl
+		resp.Secret.MaxTTL = maxTTL
+		return resp, nil
+	}
+
+	return logical.ErrorResponse(fmt.Sprintf("no accounts are available in library set %q", name)), nil
+}
+
+func (b *backend) pathLibraryCheckIn(enforce bool) framework.OperationFunc {
+	return func(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		b.libraryLock.Lock()
+		defer b.libraryLock.Unlock()
+
+		set, err := b.librarySet(ctx, req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			return logical.ErrorResponse(fmt.Sprintf("library set %q not found", name)), nil
+		}
+		enforce := enforce && !set.DisableCheckInEnforcement
+		borrower := requesterID(req)
+
+		requested := d.Get("accounts").([]string)
+		if len(requested) == 0 && !enforce {
+			return logical.ErrorResponse("accounts is required"), nil
+		}
+
+		accounts := make(map[string]*libraryAccount)
+		for _, accountName := range set.accounts(name) {
+			if len(requested) > 0 && !slices.Contains(requested, accountName) {
+				continue
+			}
+			account, err := b.libraryAccount(ctx, req.Storage, name, accountName)
+			if err != nil {
+				return nil, err
+			}
+			if account == nil || account.CheckOut == nil {
+				continue
+			}
+			if enforce && account.CheckOut.Borrower != borrower {
+				if len(requested) > 0 {
+					return logical.ErrorResponse(fmt.Sprintf("account %q is checked out by another entity", accountName)), nil
+				}
+				continue
+			}
+			accounts[accountName] = account
+		}
+		for _, accountName := range requested {
+			if !slices.Contains(set.accounts(name), accountName) {
+				return logical.ErrorResponse(fmt.Sprintf("account %q is not in library set %q", accountName, name)), nil
+			}
+		}
+
+		is, resp, err := b.libraryIssuance(ctx, req.Storage, set)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+
+		checkedIn := make([]string, 0, len(accounts))
+		for accountName, account := range accounts {
+			account.CheckOut = nil
+			if err := b.rotateLibraryAccount(ctx, req.Storage, is, name, accountName, account); err != nil {
+				return nil, err
+			}
+			checkedIn = append(checkedIn, accountName)
+		}
+		slices.Sort(checkedIn)
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"check_ins": checkedIn,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathLibraryStatus(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	set, err := b.librarySet(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return logical.ErrorResponse(fmt.Sprintf("library set %q not found", name)), nil
+	}
+
+	status := make(map[string]interface{})
+	for _, accountName := range set.accounts(name) {
+		account, err := b.libraryAccount(ctx, req.Storage, name, accountName)
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			continue
+		}
+
+		accountStatus := map[string]interface{}{"available": account.CheckOut == nil}
+		if account.CheckOut != nil {
+			accountStatus["borrower"] = account.CheckOut.Borrower
+			accountStatus["checked_out_at"] = account.CheckOut.CheckedOutAt.Format(time.RFC3339)
+		}
+		status[accountName] = accountStatus
+	}
+
+	return &logical.Response{Data: status}, nil
+}
+
+// libraryIssuance returns the roleset, config and identity client that the
+// set's accounts are managed with. Users are managed with the unscoped
+// client of their cloud, application credentials with the roleset's.
+func (b *backend) libraryIssuance(ctx context.Context, storage logical.Storage, set *librarySet) (*issuance, *logical.Response, error) {
+	role := &RoleSet{Cloud: set.Cloud}
+	if set.RoleSet != "" {
+		var err error
+		if role, err = b.Role(ctx, storage, set.RoleSet); err != nil {
+			return nil, nil, err
+		}
+		if role == nil {
+			return nil, logical.ErrorResponse(fmt.Sprintf("roleset %q not found", set.RoleSet)), nil
+		}
+		if scopeType := role.scopeType(); role.credentialType() != credentialTypeApplicationCredential || scopeType == scopeTypeDomain || scopeType == scopeTypeSystem {
+			return nil, logical.ErrorResponse("library sets need a roleset issuing project-scoped application credentials"), nil
+		}
+	}
+
+	cfg, err := b.configForRole(ctx, storage, role)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return nil, logical.ErrorResponse("access config not found"), nil
+	}
+
+	identityClient, err := b.cachedClient(ctx, cfg, role)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	return &issuance{
+		name:           set.RoleSet,
+		role:           role,
+		cfg:            cfg,
+		identityClient: identityClient,
+	}, nil, nil
+}
+
+// rotateLibraryAccount replaces the secret of an account and stores it. A
+// user gets a new password; an application credential is replaced by a new
+// one, after which the previous one is deleted. The caller must hold
+// libraryLock.
+func (b *backend) rotateLibraryAccount(ctx context.Context, storage logical.Storage, is *issuance, set, name string, account *libraryAccount) error {
+	if is.name == "" {
+		password, err := newPassword()
+		if err != nil {
+			return err
+		}
+
+		// As with static roles, the password is stored as pending before it
+		// is set, and an account left with a pending password is rotated
+		// again before it is checked out.
+		account.PendingPassword = password
+		if err := storeLibraryAccount(ctx, storage, set, name, account); err != nil {
+			return fmt.Errorf("error storing pending password: %w", err)
+		}
+
+		if err := setPassword(ctx, is.identityClient, account.UserID, password); err != nil {
+			return err
+		}
+
+		account.Password = password
+		account.PendingPassword = ""
+		if err := storeLibraryAccount(ctx, storage, set, name, account); err != nil {
+			b.Logger().Error("library account password was changed in Keystone but is only stored as pending", "set", set, "account", name, "error", err)
+			return fmt.Errorf("password was changed but could not be stored: %w", err)
+		}
+		return nil
+	}
+
+	previousID := account.ApplicationCredentialID
+	previousUserID := account.UserID
+
+	// Library credentials don't expire in Keystone; they are replaced on
+	// every check-in instead.
+	unbounded := *is
+	unbounded.maxTTL = 0
+	credentialName := fmt.Sprintf("vault-library-%s-%d", name, time.Now().UnixMilli())
+	credential, userID, walID, err := b.createApplicationCredential(ctx, storage, &unbounded, credentialName)
+	if err != nil {
+		return err
+	}
+
+	account.UserID = userID
+	account.ApplicationCredentialID = credential.ID
+	account.ApplicationCredentialSecret = credential.Secret
+	if err := storeLibraryAccount(ctx, storage, set, name, account); err != nil {
+		return fmt.Errorf("error storing library account: %w", err)
+	}
+	if err := framework.DeleteWAL(ctx, storage, walID); err != nil {
+		return fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	if previousID != "" {
+		if err := deleteLibraryCredential(ctx, storage, is.identityClient, previousUserID, previousID); err != nil {
+			b.Logger().Warn("failed to delete previous library credential", "set", set, "account", name, "id", previousID, "error", err)
+		}
+	}
+	return nil
+}
+
+// removeLibraryAccount forgets an account, deleting it in Keystone if it is
+// an application credential. Users keep their last password.
+func (b *backend) removeLibraryAccount(ctx context.Context, storage logical.Storage, is *issuance, set, name string) error {
+	account, err := b.libraryAccount(ctx, storage, set, name)
+	if err != nil {
+		return err
+	}
+	if account != nil && account.ApplicationCredentialID != "" {
+		if err := deleteLibraryCredential(ctx, storage, is.identityClient, account.UserID, account.ApplicationCredentialID); err != nil {
+			return err
+		}
+	}
+	return storage.Delete(ctx, libraryAccountPrefix+set+"/"+name)
+}
+
+func deleteLibraryCredential(ctx context.Context, storage logical.Storage, identityClient *gophercloud.ServiceClient, userID, id string) error {
+	if err := applicationcredentials.Delete(ctx, identityClient, userID, id).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting application credential %q: %w", id, err)
+	}
+	return storage.Delete(ctx, issuedCredentialPrefix+id)
+}
+
+var pathLibraryHelpSyn = "Manage a library of accounts that can be checked out"
+
+var pathLibraryHelpDesc = strings.TrimSpace(`
+A library set holds existing Keystone users, or application credentials
+created from a roleset, that callers check out exclusively with
+library/<name>/check-out and return with library/<name>/check-in. The
+password or application credential is replaced on every check-in.
+`)
@@ -0,0 +1,236 @@
+package openstack
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestLibrary_Users(t *testing.T) {
+	t.Parallel()
+
+	lt := newKeystoneTest(t)
+
+	lt.mustRequest(logical.CreateOperation, "library/team", "", map[string]interface{}{
+		"user_ids": "user456",
+		"ttl":      "1h",
+	})
+	if n := lt.ks.passwordUpdates.Load(); n != 1 {
+		t.Fatalf("expected the password to be rotated when added, got %d updates", n)
+	}
+
+	resp := lt.mustRequest(logical.UpdateOperation, "library/team/check-out", "alice", nil)
+	if resp.Data["username"] != "alice" || resp.Data["password"] == "" {
+		t.Fatalf("unexpected check-out: %v", resp.Data)
+	}
+	lease := resp.Secret
+
+	// Checked out accounts aren't handed out again
+	resp = lt.request(logical.UpdateOperation, "library/team/check-out", "bob", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected no accounts to be available")
+	}
+
+	resp = lt.mustRequest(logical.ReadOperation, "library/team/status", "", nil)
+	if status := resp.Data["user456"].(map[string]interface{}); status["available"] != false || status["borrower"] != "alice" {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	// Only the borrower can check in, unless forced
+	resp = lt.request(logical.UpdateOperation, "library/team/check-in", "bob", map[string]interface{}{
+		"accounts": "user456",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected check-in by another entity to fail")
+	}
+	resp = lt.mustRequest(logical.UpdateOperation, "library/team/check-in", "alice", nil)
+	if checkIns := resp.Data["check_ins"].([]string); !slices.Equal(checkIns, []string{"user456"}) {
+		t.Errorf("unexpected check-ins: %v", checkIns)
+	}
+	if n := lt.ks.passwordUpdates.Load(); n != 2 {
+		t.Errorf("expected the password to be rotated on check-in, got %d updates", n)
+	}
+
+	// A stale lease doesn't check in a later check-out
+	lt.mustRequest(logical.UpdateOperation, "library/team/check-out", "bob", nil)
+	if _, err := lt.b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   lt.storage,
+		Secret:    lease,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp = lt.mustRequest(logical.ReadOperation, "library/team/status", "", nil)
+	if status := resp.Data["user456"].(map[string]interface{}); status["borrower"] != "bob" {
+		t.Errorf("expected the account to stay checked out, got %v", status)
+	}
+
+	resp = lt.request(logical.DeleteOperation, "library/team", "", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected deleting a set with checked out accounts to fail")
+	}
+
+	lt.mustRequest(logical.UpdateOperation, "library/manage/team/check-in", "", map[string]interface{}{
+		"accounts": "user456",
+	})
+	lt.mustRequest(logical.DeleteOperation, "library/team", "", nil)
+
+	resp = lt.mustRequest(logical.ListOperation, "library/", "", nil)
+	if len(resp.Data) != 0 {
+		t.Errorf("expected no library sets, got %v", resp.Data)
+	}
+}
+
+func TestLibrary_PendingPassword(t *testing.T) {
+	t.Parallel()
+
+	lt := newKeystoneTest(t)
+
+	lt.mustRequest(logical.CreateOperation, "library/team", "", map[string]interface{}{
+		"user_ids": "user456",
+	})
+
+	// The account was left with a pending password by an interrupted
+	// rotation, so it is rotated again before it is checked out.
+	backend := lt.b.(*backend)
+	account, err := backend.libraryAccount(context.Background(), lt.storage, "team", "user456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account.PendingPassword = "interrupted"
+	if err := storeLibraryAccount(context.Background(), lt.storage, "team", "user456", account); err != nil {
+		t.Fatal(err)
+	}
+	previous := account.Password
+
+	resp := lt.mustRequest(logical.UpdateOperation, "library/team/check-out", "alice", nil)
+	if n := lt.ks.passwordUpdates.Load(); n != 2 {
+		t.Errorf("expected the password to be rotated before check-out, got %d updates", n)
+	}
+	if password := resp.Data["password"]; password == previous || password == "interrupted" {
+		t.Errorf("expected a new password, got %v", password)
+	}
+	if account, err = backend.libraryAccount(context.Background(), lt.storage, "team", "user456"); err != nil {
+		t.Fatal(err)
+	}
+	if account.PendingPassword != "" || account.Password != resp.Data["password"] {
+		t.Errorf("expected the new password to be stored, got %#v", account)
+	}
+}
+
+func TestLibrary_RoleSet(t *testing.T) {
+	t.Parallel()
+
+	lt := newKeystoneTest(t)
+
+	lt.mustRequest(logical.UpdateOperation, "roleset/member", "", map[string]interface{}{
+		"project_id":        "project123",
+		"roles":             "member",
+		"verify_connection": false,
+	})
+	lt.mustRequest(logical.CreateOperation, "library/ci", "", map[string]interface{}{
+		"roleset": "member",
+		"size":    2,
+	})
+	if n := lt.ks.appCredCreates.Load(); n != 2 {
+		t.Fatalf("expected 2 application credentials, got %d", n)
+	}
+
+	resp := lt.mustRequest(logical.UpdateOperation, "library/ci/check-out", "alice", nil)
+	if resp.Data["account"] != "ci-1" || resp.Data["application_credential_id"] != "appcred-1" {
+		t.Fatalf("unexpected check-out: %v", resp.Data)
+	}
+
+	// Shrinking the set can't remove a checked out account
+	lt.mustRequest(logical.UpdateOperation, "library/ci", "", map[string]interface{}{"size": 1})
+	resp = lt.request(logical.UpdateOperation, "library/ci", "", map[string]interface{}{"size": 0})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected shrinking past a checked out account to fail")
+	}
+	if n := lt.ks.appCredDeletes.Load(); n != 1 {
+		t.Errorf("expected the removed credential to be deleted, got %d deletes", n)
+	}
+
+	// Checking in replaces the application credential
+	lt.mustRequest(logical.UpdateOperation, "library/ci/check-in", "alice", nil)
+	if n := lt.ks.appCredCreates.Load(); n != 3 {
+		t.Errorf("expected a new application credential on check-in, got %d creates", n)
+	}
+	if n := lt.ks.appCredDeletes.Load(); n != 2 {
+		t.Errorf("expected the previous credential to be deleted, got %d deletes", n)
+	}
+
+	// A set can't be deleted while an account is checked out
+	lt.mustRequest(logical.UpdateOperation, "library/ci/check-out", "alice", nil)
+	resp = lt.request(logical.DeleteOperation, "library/ci", "", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected deleting a set with checked out accounts to fail")
+	}
+	if n := lt.ks.appCredDeletes.Load(); n != 2 {
+		t.Errorf("expected no credentials to be deleted, got %d deletes", n)
+	}
+	resp = lt.mustRequest(logical.ReadOperation, "library/ci/status", "", nil)
+	if status := resp.Data["ci-1"].(map[string]interface{}); status["borrower"] != "alice" {
+		t.Errorf("expected the account to stay checked out, got %v", status)
+	}
+	lt.mustRequest(logical.UpdateOperation, "library/ci/check-in", "alice", nil)
+
+	lt.mustRequest(logical.DeleteOperation, "library/ci", "", nil)
+	if n := lt.ks.appCredDeletes.Load(); n != 4 {
+		t.Errorf("expected the credentials to be deleted with the set, got %d deletes", n)
+	}
+	tracked, err := lt.storage.List(context.Background(), issuedCredentialPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracked) != 0 {
+		t.Errorf("expected no tracked credentials, got %v", tracked)
+	}
+}
+
+func TestLibrary_Validation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{
+			name: "no accounts",
+			data: map[string]interface{}{"ttl": "1h"},
+		},
+		{
+			name: "users and roleset",
+			data: map[string]interface{}{"user_ids": "user456", "roleset": "member", "size": 1},
+		},
+		{
+			name: "roleset without size",
+			data: map[string]interface{}{"roleset": "member"},
+		},
+		{
+			name: "duplicate users",
+			data: map[string]interface{}{"user_ids": "user456,user456"},
+		},
+		{
+			name: "configured user",
+			data: map[string]interface{}{"user_ids": "user123"},
+		},
+		{
+			name: "ttl above max_ttl",
+			data: map[string]interface{}{"user_ids": "user456", "ttl": "2h", "max_ttl": "1h"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			lt := newKeystoneTest(t)
+
+			resp := lt.request(logical.CreateOperation, "library/team", "", tc.data)
+			if resp == nil || !resp.IsError() {
+				t.Fatal("expected error response")
+			}
+		})
+	}
+}
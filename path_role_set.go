@@ -1,12 +1,18 @@
 package openstack
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"time"
 
+	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -45,9 +51,94 @@ func pathRoles(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Domain name for project scoping",
 			},
+			"scope_type": {
+				Type:        framework.TypeString,
+				Description: "Scope to authenticate with: project (default when a project is set), domain or system",
+			},
+			"domain_id": {
+				Type:        framework.TypeString,
+				Description: "Domain ID for domain-scoped rolesets",
+			},
+			"domain_name": {
+				Type:        framework.TypeString,
+				Description: "Domain name for domain-scoped rolesets",
+			},
+			"credential_type": {
+				Type:        framework.TypeString,
+				Description: "Type of credential to issue: application_credential (default), dynamic_user, ec2, trust or ephemeral_project",
+			},
+			"user_domain_id": {
+				Type:        framework.TypeString,
+				Description: "Domain ID in which dynamic users are created",
+			},
+			"parent_project_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the project under which ephemeral projects are created",
+			},
+			"quotas": {
+				Type:        framework.TypeString,
+				Description: "JSON object of compute, network and volume quotas set on ephemeral projects",
+			},
+			"impersonation": {
+				Type:        framework.TypeBool,
+				Description: "Whether trustees of issued trusts act as the configured user",
+			},
+			"allowed_trustee_user_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IDs of the users that trusts may be issued to",
+			},
+			"allowed_grantee_user_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IDs of the users that the roleset's roles may be granted to",
+			},
+			"allowed_grantee_group_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "IDs of the groups that the roleset's roles may be granted to",
+			},
+			"cloud": {
+				Type:        framework.TypeString,
+				Description: "Name of the config/cloud entry to issue credentials from; defaults to config/auth",
+			},
 			"roles": {
+				Type:        framework.TypeSlice,
+				Description: "Roles for the application credential, as a comma-separated list of names, a list of objects with id, name and domain_id, or a JSON array",
+			},
+			"role_ids": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma-separated list of role IDs for the application credential, combined with roles",
+			},
+			"access_rules": {
 				Type:        framework.TypeString,
-				Description: "JSON array of roles for the application credential",
+				Description: "JSON array of access rules (service, method, path) restricting the application credential",
+			},
+			"ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Lease TTL for issued credentials, overriding config/lease",
+			},
+			"verify_connection": {
+				Type:        framework.TypeBool,
+				Description: "Resolve the roleset's project and roles in Keystone before storing it",
+				Default:     true,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lease TTL for issued credentials, overriding config/lease",
+			},
+			"pool_size": {
+				Type:        framework.TypeInt,
+				Description: "Number of application credentials to keep created ahead of time for immediate issuance",
+			},
+			"max_active_leases": {
+				Type:        framework.TypeInt,
+				Description: "Maximum number of unexpired leases issued from the roleset at once; 0 means unlimited",
+			},
+			"rate_limit": {
+				Type:        framework.TypeInt,
+				Description: "Maximum number of credentials each entity can read from the roleset per rate_limit_period; 0 means unlimited",
+			},
+			"rate_limit_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Period that rate_limit applies to; defaults to one minute",
 			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -111,11 +202,32 @@ func (b *backend) pathRolesRead(ctx context.Context, req *logical.Request, d *fr
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"project_id":          role.ProjectID,
-			"project_name":        role.ProjectName,
-			"project_domain_id":   role.ProjectDomainID,
-			"project_domain_name": role.ProjectDomainName,
-			"roles":               role.Roles,
+			"project_id":                role.ProjectID,
+			"project_name":              role.ProjectName,
+			"project_domain_id":         role.ProjectDomainID,
+			"project_domain_name":       role.ProjectDomainName,
+			"resolved_project_id":       role.ResolvedProjectID,
+			"resolved_project_name":     role.ResolvedProjectName,
+			"scope_type":                role.scopeType(),
+			"domain_id":                 role.DomainID,
+			"domain_name":               role.DomainName,
+			"cloud":                     role.Cloud,
+			"credential_type":           role.credentialType(),
+			"user_domain_id":            role.UserDomainID,
+			"impersonation":             role.Impersonation,
+			"allowed_trustee_user_ids":  role.AllowedTrusteeUserIDs,
+			"allowed_grantee_user_ids":  role.AllowedGranteeUserIDs,
+			"allowed_grantee_group_ids": role.AllowedGranteeGroupIDs,
+			"parent_project_id":         role.ParentProjectID,
+			"quotas":                    role.Quotas,
+			"roles":                     role.Roles,
+			"access_rules":              role.AccessRules,
+			"ttl":                       int64(role.TTL.Seconds()),
+			"max_ttl":                   int64(role.MaxTTL.Seconds()),
+			"pool_size":                 role.PoolSize,
+			"max_active_leases":         role.MaxActiveLeases,
+			"rate_limit":                role.RateLimit,
+			"rate_limit_period":         int64(role.rateLimitPeriod().Seconds()),
 		},
 	}, nil
 }
@@ -128,7 +240,11 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		return nil, err
 	}
 	if role == nil {
-		role = new(RoleSet)
+		instanceID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		role = &RoleSet{InstanceID: instanceID}
 	}
 
 	if projectID, ok := d.GetOk("project_id"); ok {
@@ -143,12 +259,151 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 	if projectDomainName, ok := d.GetOk("project_domain_name"); ok {
 		role.ProjectDomainName = projectDomainName.(string)
 	}
-	if rawRoles, ok := d.GetOk("roles"); ok {
+	if scopeType, ok := d.GetOk("scope_type"); ok {
+		role.ScopeType = scopeType.(string)
+	}
+	// The project resolved for the previous scope no longer applies; it is
+	// resolved again if the roleset is verified.
+	for _, field := range []string{"project_id", "project_name", "project_domain_id", "project_domain_name", "scope_type"} {
+		if _, ok := d.GetOk(field); ok {
+			role.ResolvedProjectID, role.ResolvedProjectName, role.ResolvedProjectDomainID = "", "", ""
+			break
+		}
+	}
+	if domainID, ok := d.GetOk("domain_id"); ok {
+		role.DomainID = domainID.(string)
+	}
+	if domainName, ok := d.GetOk("domain_name"); ok {
+		role.DomainName = domainName.(string)
+	}
+	if credentialType, ok := d.GetOk("credential_type"); ok {
+		role.CredentialType = credentialType.(string)
+		if !credentialTypes[role.credentialType()] {
+			return logical.ErrorResponse(fmt.Sprintf("invalid credential_type %q", role.CredentialType)), nil
+		}
+	}
+	if userDomainID, ok := d.GetOk("user_domain_id"); ok {
+		role.UserDomainID = userDomainID.(string)
+	}
+	if parentProjectID, ok := d.GetOk("parent_project_id"); ok {
+		role.ParentProjectID = parentProjectID.(string)
+	}
+	if rawQuotas, ok := d.GetOk("quotas"); ok {
+		quotas, err := parseProjectQuotas(rawQuotas.(string))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid quotas: %s", err)), nil
+		}
+		role.Quotas = quotas
+	}
+	if impersonation, ok := d.GetOk("impersonation"); ok {
+		role.Impersonation = impersonation.(bool)
+	}
+	if allowedTrusteeUserIDs, ok := d.GetOk("allowed_trustee_user_ids"); ok {
+		role.AllowedTrusteeUserIDs = allowedTrusteeUserIDs.([]string)
+	}
+	if allowedGranteeUserIDs, ok := d.GetOk("allowed_grantee_user_ids"); ok {
+		role.AllowedGranteeUserIDs = allowedGranteeUserIDs.([]string)
+	}
+	if allowedGranteeGroupIDs, ok := d.GetOk("allowed_grantee_group_ids"); ok {
+		role.AllowedGranteeGroupIDs = allowedGranteeGroupIDs.([]string)
+	}
+	if cloud, ok := d.GetOk("cloud"); ok {
+		role.Cloud = cloud.(string)
+		if role.Cloud != "" {
+			cfg, err := b.readConfigCloud(ctx, req.Storage, role.Cloud)
+			if err != nil {
+				return nil, err
+			}
+			if cfg == nil {
+				return logical.ErrorResponse(fmt.Sprintf("cloud %q not found", role.Cloud)), nil
+			}
+		}
+	}
+	rawRoles, hasRoles := d.GetOk("roles")
+	rawRoleIDs, hasRoleIDs := d.GetOk("role_ids")
+	if hasRoles || hasRoleIDs {
 		var roles []applicationcredentials.Role
-		if err := json.Unmarshal([]byte(rawRoles.(string)), &roles); err != nil {
-			return nil, fmt.Errorf("invalid roles JSON: %w", err)
+		if hasRoles {
+			roles, err = parseRoles(rawRoles.([]interface{}))
+			if err != nil {
+				return nil, err
+			}
+		}
+		if hasRoleIDs {
+			for _, roleID := range rawRoleIDs.([]string) {
+				roles = append(roles, applicationcredentials.Role{ID: roleID})
+			}
+		}
+		role.Roles = normalizeRoles(roles)
+	}
+	if rawAccessRules, ok := d.GetOk("access_rules"); ok {
+		var accessRules []applicationcredentials.AccessRule
+		if err := json.Unmarshal([]byte(rawAccessRules.(string)), &accessRules); err != nil {
+			return nil, fmt.Errorf("invalid access_rules JSON: %w", err)
+		}
+		if err := validateAccessRules(accessRules); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		role.AccessRules = accessRules
+	}
+	if ttl, ok := d.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttl.(int)) * time.Second
+	}
+	if maxTTL, ok := d.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTL.(int)) * time.Second
+	}
+	if err := role.validateScope(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.credentialType() == credentialTypeEphemeralProject && role.HasProject() {
+		return logical.ErrorResponse("ephemeral_project rolesets create their own project; use parent_project_id instead of project_id or project_name"), nil
+	}
+	if poolSize, ok := d.GetOk("pool_size"); ok {
+		role.PoolSize = poolSize.(int)
+	}
+	if role.PoolSize < 0 {
+		return logical.ErrorResponse("pool_size cannot be negative"), nil
+	}
+	if role.PoolSize > 0 {
+		scopeType := role.scopeType()
+		if role.credentialType() != credentialTypeApplicationCredential || scopeType == scopeTypeDomain || scopeType == scopeTypeSystem {
+			return logical.ErrorResponse("pool_size is only supported for rolesets issuing project-scoped application credentials"), nil
+		}
+	}
+	if maxActiveLeases, ok := d.GetOk("max_active_leases"); ok {
+		role.MaxActiveLeases = maxActiveLeases.(int)
+	}
+	if rateLimit, ok := d.GetOk("rate_limit"); ok {
+		role.RateLimit = rateLimit.(int)
+	}
+	if rateLimitPeriod, ok := d.GetOk("rate_limit_period"); ok {
+		role.RateLimitPeriod = time.Duration(rateLimitPeriod.(int)) * time.Second
+	}
+	if role.MaxActiveLeases < 0 || role.RateLimit < 0 || role.RateLimitPeriod < 0 {
+		return logical.ErrorResponse("max_active_leases, rate_limit and rate_limit_period cannot be negative"), nil
+	}
+	if role.MaxTTL > 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	var warnings []string
+	if role.credentialType() == credentialTypeTrust && len(role.AllowedTrusteeUserIDs) == 0 {
+		warnings = append(warnings, "no allowed_trustee_user_ids are set, so no trusts can be issued from the roleset")
+	}
+	if d.Get("verify_connection").(bool) {
+		cfg, err := b.configForRole(ctx, req.Storage, role)
+		if err != nil {
+			return nil, fmt.Errorf("error reading access config: %w", err)
+		}
+		if cfg == nil {
+			warnings = append(warnings, "no access config found; the roleset was stored without verifying it")
+		} else {
+			verifyWarnings, err := verifyRoleSet(ctx, cfg, role)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			warnings = append(warnings, verifyWarnings...)
 		}
-		role.Roles = roles
 	}
 
 	entry, err := logical.StorageEntryJSON("roleset/"+name, role)
@@ -160,25 +415,364 @@ func (b *backend) pathRolesWrite(ctx context.Context, req *logical.Request, d *f
 		return nil, err
 	}
 
-	return nil, nil
+	// Pooled credentials created from the previous definition are discarded
+	// and the pool is filled for the new one.
+	b.refillPoolAsync(req.Storage, name)
+
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	resp := &logical.Response{}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
 }
 
 func (b *backend) pathRolesDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
+	role, err := b.Role(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := req.Storage.Delete(ctx, "roleset/"+name); err != nil {
 		return nil, err
 	}
+	if role != nil {
+		if err := b.deleteRoleSetLimits(ctx, req.Storage, name, role); err != nil {
+			return nil, fmt.Errorf("error deleting active lease count: %w", err)
+		}
+	}
+
+	b.refillPoolAsync(req.Storage, name)
 	return nil, nil
 }
 
 type RoleSet struct {
-	ProjectID         string                       `json:"project_id,omitempty"`
-	ProjectName       string                       `json:"project_name,omitempty"`
-	ProjectDomainID   string                       `json:"project_domain_id,omitempty"`
-	ProjectDomainName string                       `json:"project_domain_name,omitempty"`
-	Roles             []applicationcredentials.Role `json:"roles,omitempty"`
+	ProjectID              string                              `json:"project_id,omitempty"`
+	ProjectName            string                              `json:"project_name,omitempty"`
+	ProjectDomainID        string                              `json:"project_domain_id,omitempty"`
+	ProjectDomainName      string                              `json:"project_domain_name,omitempty"`
+	ScopeType              string                              `json:"scope_type,omitempty"`
+	DomainID               string                              `json:"domain_id,omitempty"`
+	DomainName             string                              `json:"domain_name,omitempty"`
+	Cloud                  string                              `json:"cloud,omitempty"`
+	CredentialType         string                              `json:"credential_type,omitempty"`
+	UserDomainID           string                              `json:"user_domain_id,omitempty"`
+	Impersonation          bool                                `json:"impersonation,omitempty"`
+	AllowedTrusteeUserIDs  []string                            `json:"allowed_trustee_user_ids,omitempty"`
+	AllowedGranteeUserIDs  []string                            `json:"allowed_grantee_user_ids,omitempty"`
+	AllowedGranteeGroupIDs []string                            `json:"allowed_grantee_group_ids,omitempty"`
+	ParentProjectID        string                              `json:"parent_project_id,omitempty"`
+	Quotas                 *projectQuotas                      `json:"quotas,omitempty"`
+	Roles                  []applicationcredentials.Role       `json:"roles,omitempty"`
+	AccessRules            []applicationcredentials.AccessRule `json:"access_rules,omitempty"`
+	TTL                    time.Duration                       `json:"ttl,omitempty"`
+	MaxTTL                 time.Duration                       `json:"max_ttl,omitempty"`
+	PoolSize               int                                 `json:"pool_size,omitempty"`
+	MaxActiveLeases        int                                 `json:"max_active_leases,omitempty"`
+	RateLimit              int                                 `json:"rate_limit,omitempty"`
+	RateLimitPeriod        time.Duration                       `json:"rate_limit_period,omitempty"`
+
+	// ResolvedProjectID, ResolvedProjectName and ResolvedProjectDomainID
+	// hold the project that verification resolved the roleset's project to.
+	// They are kept apart from the project the roleset was written with,
+	// which is what it authenticates with.
+	ResolvedProjectID       string `json:"resolved_project_id,omitempty"`
+	ResolvedProjectName     string `json:"resolved_project_name,omitempty"`
+	ResolvedProjectDomainID string `json:"resolved_project_domain_id,omitempty"`
+
+	// InstanceID tells this roleset apart from earlier ones with the same
+	// name; its active lease count is kept per instance.
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// verifyRoleSet authenticates with the roleset's scope and resolves its
+// project and roles in Keystone, storing their IDs on the roleset alongside
+// the names. Problems
+// that don't stop credentials from being issued are returned as warnings.
+func verifyRoleSet(ctx context.Context, cfg *Config, role *RoleSet) ([]string, error) {
+	if cfg.UsesApplicationCredential() && role.HasScope() {
+		return nil, errors.New("cannot use application credential authentication with scoped rolesets; " +
+			"application credentials are bound to their original project")
+	}
+
+	identityClient, err := client(ctx, cfg, role)
+	if err != nil {
+		return nil, fmt.Errorf("unable to authenticate with the roleset's scope: %s", authErrorMessage(err))
+	}
+	result, err := authResult(identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	project, err := result.ExtractProject()
+	if err != nil {
+		return nil, fmt.Errorf("extract project from token: %w", err)
+	}
+	if role.scopeType() == scopeTypeProject {
+		if project == nil || project.ID == "" {
+			return nil, errors.New("token is not scoped to the roleset's project")
+		}
+		role.ResolvedProjectID = project.ID
+		role.ResolvedProjectName = project.Name
+		role.ResolvedProjectDomainID = project.Domain.ID
+	}
+
+	var warnings []string
+	resolved := make([]applicationcredentials.Role, 0, len(role.Roles))
+	for _, ref := range role.Roles {
+		found, err := findRole(ctx, identityClient, ref)
+		if gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+			warnings = append(warnings, fmt.Sprintf("the configured user may not look up roles, so they were not verified: %s", err))
+			return warnings, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		resolved = append(resolved, applicationcredentials.Role{
+			ID:       found.ID,
+			Name:     found.Name,
+			DomainID: found.DomainID,
+		})
+	}
+	role.Roles = resolved
+
+	// Application credentials and trusts can only delegate roles that the
+	// configured user holds on the project itself.
+	delegates := role.credentialType() == credentialTypeApplicationCredential || role.credentialType() == credentialTypeTrust
+	if delegates && project != nil && project.ID != "" {
+		tokenRoles, err := result.ExtractRoles()
+		if err != nil {
+			return nil, fmt.Errorf("extract roles from token: %w", err)
+		}
+		held := make(map[string]bool, len(tokenRoles))
+		for _, tokenRole := range tokenRoles {
+			held[tokenRole.ID] = true
+		}
+		for _, r := range resolved {
+			if !held[r.ID] {
+				warnings = append(warnings, fmt.Sprintf("the configured user does not hold role %q on project %q and can't delegate it", r.Name, project.Name))
+			}
+		}
+	}
+
+	return warnings, nil
 }
 
 func (r *RoleSet) HasProject() bool {
 	return r.ProjectID != "" || r.ProjectName != ""
 }
+
+// HasScope reports whether the roleset authenticates with a scope of its own
+// rather than the configured user's default scope.
+func (r *RoleSet) HasScope() bool {
+	return r.scopeType() != ""
+}
+
+const (
+	scopeTypeProject = "project"
+	scopeTypeDomain  = "domain"
+	scopeTypeSystem  = "system"
+)
+
+// scopeType returns the scope the roleset authenticates with. Rolesets
+// without an explicit scope_type are project-scoped when they name a project
+// and use the default scope otherwise.
+func (r *RoleSet) scopeType() string {
+	if r.ScopeType != "" {
+		return r.ScopeType
+	}
+	if r.HasProject() {
+		return scopeTypeProject
+	}
+	return ""
+}
+
+func (r *RoleSet) validateScope() error {
+	hasDomain := r.DomainID != "" || r.DomainName != ""
+
+	switch r.scopeType() {
+	case "":
+		if hasDomain {
+			return errors.New("domain_id and domain_name require scope_type=domain")
+		}
+	case scopeTypeProject:
+		if !r.HasProject() {
+			return errors.New("project-scoped rolesets require project_id or project_name")
+		}
+		if hasDomain {
+			return errors.New("domain_id and domain_name require scope_type=domain")
+		}
+	case scopeTypeDomain:
+		if !hasDomain {
+			return errors.New("domain-scoped rolesets require domain_id or domain_name")
+		}
+		if r.HasProject() {
+			return errors.New("domain-scoped rolesets cannot set project_id or project_name")
+		}
+	case scopeTypeSystem:
+		if hasDomain || r.HasProject() {
+			return errors.New("system-scoped rolesets cannot set a project or domain")
+		}
+	default:
+		return fmt.Errorf("invalid scope_type %q", r.ScopeType)
+	}
+
+	return nil
+}
+
+// authScope returns the scope to authenticate with for the roleset, or nil to
+// use the configured user's default scope. Project names without a project
+// domain are looked up in the user's domain.
+func (r *RoleSet) authScope(cfg *Config) *gophercloud.AuthScope {
+	switch r.scopeType() {
+	case scopeTypeSystem:
+		return &gophercloud.AuthScope{System: true}
+	case scopeTypeDomain:
+		if r.DomainID != "" {
+			return &gophercloud.AuthScope{DomainID: r.DomainID}
+		}
+		return &gophercloud.AuthScope{DomainName: r.DomainName}
+	case scopeTypeProject:
+		if r.ProjectID != "" {
+			return &gophercloud.AuthScope{ProjectID: r.ProjectID}
+		}
+
+		scope := &gophercloud.AuthScope{ProjectName: r.ProjectName}
+		switch {
+		case r.ProjectDomainID != "":
+			scope.DomainID = r.ProjectDomainID
+		case r.ProjectDomainName != "":
+			scope.DomainName = r.ProjectDomainName
+		case cfg.UserDomainID != "":
+			scope.DomainID = cfg.UserDomainID
+		default:
+			scope.DomainName = cfg.UserDomainName
+		}
+		return scope
+	}
+
+	return nil
+}
+
+const (
+	credentialTypeApplicationCredential = "application_credential"
+	credentialTypeDynamicUser           = "dynamic_user"
+	credentialTypeEC2                   = "ec2"
+	credentialTypeTrust                 = "trust"
+	credentialTypeEphemeralProject      = "ephemeral_project"
+)
+
+var credentialTypes = map[string]bool{
+	credentialTypeApplicationCredential: true,
+	credentialTypeDynamicUser:           true,
+	credentialTypeEC2:                   true,
+	credentialTypeTrust:                 true,
+	credentialTypeEphemeralProject:      true,
+}
+
+// credentialType returns the type of credential issued from the roleset;
+// rolesets without one issue application credentials.
+func (r *RoleSet) credentialType() string {
+	if r.CredentialType == "" {
+		return credentialTypeApplicationCredential
+	}
+	return r.CredentialType
+}
+
+var accessRuleMethods = map[string]bool{
+	"GET":    true,
+	"HEAD":   true,
+	"POST":   true,
+	"PUT":    true,
+	"PATCH":  true,
+	"DELETE": true,
+}
+
+// parseRoles converts the roles field into role references. Each entry is
+// either a map with id, name and domain_id keys, a JSON array or object as
+// previously stored in the field, or a comma-separated list of role names.
+func parseRoles(raw []interface{}) ([]applicationcredentials.Role, error) {
+	var roles []applicationcredentials.Role
+	for _, entry := range raw {
+		switch entry := entry.(type) {
+		case string:
+			entry = strings.TrimSpace(entry)
+			switch {
+			case strings.HasPrefix(entry, "["):
+				var parsed []applicationcredentials.Role
+				if err := json.Unmarshal([]byte(entry), &parsed); err != nil {
+					return nil, fmt.Errorf("invalid roles JSON: %w", err)
+				}
+				roles = append(roles, parsed...)
+			case strings.HasPrefix(entry, "{"):
+				var parsed applicationcredentials.Role
+				if err := json.Unmarshal([]byte(entry), &parsed); err != nil {
+					return nil, fmt.Errorf("invalid roles JSON: %w", err)
+				}
+				roles = append(roles, parsed)
+			default:
+				for _, name := range strings.Split(entry, ",") {
+					roles = append(roles, applicationcredentials.Role{Name: name})
+				}
+			}
+		case map[string]interface{}:
+			encoded, err := json.Marshal(entry)
+			if err != nil {
+				return nil, err
+			}
+			decoder := json.NewDecoder(bytes.NewReader(encoded))
+			decoder.DisallowUnknownFields()
+
+			var parsed applicationcredentials.Role
+			if err := decoder.Decode(&parsed); err != nil {
+				return nil, fmt.Errorf("invalid role %v: %w", entry, err)
+			}
+			roles = append(roles, parsed)
+		default:
+			return nil, fmt.Errorf("invalid role of type %T", entry)
+		}
+	}
+	return roles, nil
+}
+
+// normalizeRoles trims the role references, drops empty and duplicate
+// entries and keeps the remaining ones in the order they were given, so that
+// the same roles read back the same way whichever format they were written in.
+func normalizeRoles(roles []applicationcredentials.Role) []applicationcredentials.Role {
+	seen := make(map[applicationcredentials.Role]bool, len(roles))
+	normalized := make([]applicationcredentials.Role, 0, len(roles))
+	for _, role := range roles {
+		role = applicationcredentials.Role{
+			ID:       strings.TrimSpace(role.ID),
+			Name:     strings.TrimSpace(role.Name),
+			DomainID: strings.TrimSpace(role.DomainID),
+		}
+		if role.ID == "" && role.Name == "" {
+			continue
+		}
+		if seen[role] {
+			continue
+		}
+		seen[role] = true
+		normalized = append(normalized, role)
+	}
+	return normalized
+}
+
+func validateAccessRules(rules []applicationcredentials.AccessRule) error {
+	for i, rule := range rules {
+		if rule.Service == "" {
+			return fmt.Errorf("access rule %d: service is required", i)
+		}
+		if !accessRuleMethods[rule.Method] {
+			return fmt.Errorf("access rule %d: invalid method %q", i, rule.Method)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("access rule %d: path must start with \"/\"", i)
+		}
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package openstack
 
 import (
 	"context"
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
 	"github.com/hashicorp/vault/sdk/logical"
 )
@@ -223,7 +227,7 @@ func TestRoleSet_InvalidJSON(t *testing.T) {
 		Operation: logical.CreateOperation,
 		Path:      "roleset/test",
 		Data: map[string]interface{}{
-			"roles": `invalid json`,
+			"roles": `[invalid json`,
 		},
 		Storage: reqStorage,
 	})
@@ -292,3 +296,754 @@ func TestRole_EmptyName(t *testing.T) {
 		t.Errorf("expected 'invalid roleset name' error, got: %v", err)
 	}
 }
+
+func TestRoleSet_AccessRules(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"roles":        `[{"name": "member"}]`,
+			"access_rules": `[{"service": "object-store", "method": "PUT", "path": "/v1/*/ci-artifacts/**"}]`,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules, ok := resp.Data["access_rules"].([]applicationcredentials.AccessRule)
+	if !ok {
+		t.Fatalf("expected access_rules to be []applicationcredentials.AccessRule, got %T", resp.Data["access_rules"])
+	}
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 access rule, got %d", len(rules))
+	}
+	if rules[0].Service != "object-store" || rules[0].Method != "PUT" || rules[0].Path != "/v1/*/ci-artifacts/**" {
+		t.Errorf("unexpected access rule: %+v", rules[0])
+	}
+}
+
+func TestRoleSet_InvalidAccessRules(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{
+			name:  "missing service",
+			rules: `[{"method": "GET", "path": "/v1/**"}]`,
+		},
+		{
+			name:  "invalid method",
+			rules: `[{"service": "compute", "method": "FETCH", "path": "/v2.1/servers"}]`,
+		},
+		{
+			name:  "relative path",
+			rules: `[{"service": "compute", "method": "GET", "path": "v2.1/servers"}]`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roleset/test",
+				Data: map[string]interface{}{
+					"access_rules": tc.rules,
+				},
+				Storage: reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatal("expected error response")
+			}
+		})
+	}
+}
+
+func TestRoleSet_TTL(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"ttl":     "1h",
+			"max_ttl": "24h",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["ttl"] != int64(3600) {
+		t.Errorf("expected ttl=3600, got %v", resp.Data["ttl"])
+	}
+	if resp.Data["max_ttl"] != int64(86400) {
+		t.Errorf("expected max_ttl=86400, got %v", resp.Data["max_ttl"])
+	}
+
+	// A ttl above max_ttl is rejected
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"ttl": "48h",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for ttl greater than max_ttl")
+	}
+}
+
+func TestRoleSet_CredentialType(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	// Rolesets issue application credentials by default
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"project_id": "project123",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["credential_type"] != credentialTypeApplicationCredential {
+		t.Errorf("expected credential_type=%s, got %v", credentialTypeApplicationCredential, resp.Data["credential_type"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"credential_type": "dynamic_user",
+			"user_domain_id":  "default",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["credential_type"] != credentialTypeDynamicUser {
+		t.Errorf("expected credential_type=%s, got %v", credentialTypeDynamicUser, resp.Data["credential_type"])
+	}
+	if resp.Data["user_domain_id"] != "default" {
+		t.Errorf("expected user_domain_id=default, got %v", resp.Data["user_domain_id"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"credential_type": "ec2",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"credential_type":          "trust",
+			"impersonation":            true,
+			"allowed_trustee_user_ids": "user456",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "roleset/test",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["credential_type"] != credentialTypeTrust {
+		t.Errorf("expected credential_type=%s, got %v", credentialTypeTrust, resp.Data["credential_type"])
+	}
+	if resp.Data["impersonation"] != true {
+		t.Errorf("expected impersonation=true, got %v", resp.Data["impersonation"])
+	}
+	if ids, ok := resp.Data["allowed_trustee_user_ids"].([]string); !ok || len(ids) != 1 || ids[0] != "user456" {
+		t.Errorf("expected allowed_trustee_user_ids=[user456], got %v", resp.Data["allowed_trustee_user_ids"])
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"credential_type": "unknown",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for unknown credential_type")
+	}
+}
+
+func TestRoleSet_EphemeralProject(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/preview",
+		Data: map[string]interface{}{
+			"credential_type":   "ephemeral_project",
+			"parent_project_id": "parent123",
+			"project_domain_id": "default",
+			"roles":             `[{"name": "member"}]`,
+			"quotas":            `{"compute": {"instances": 2, "cores": 4}, "volume": {"gigabytes": 50}}`,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	role, err := b.(*backend).Role(context.Background(), reqStorage, "preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ParentProjectID != "parent123" {
+		t.Errorf("expected parent_project_id=parent123, got %q", role.ParentProjectID)
+	}
+	if role.Quotas == nil || role.Quotas.Compute == nil || *role.Quotas.Compute.Instances != 2 {
+		t.Fatalf("expected compute instances quota of 2, got %#v", role.Quotas)
+	}
+	if role.Quotas.Volume == nil || *role.Quotas.Volume.Gigabytes != 50 {
+		t.Errorf("expected volume gigabytes quota of 50, got %#v", role.Quotas.Volume)
+	}
+	if role.Quotas.Network != nil {
+		t.Errorf("expected no network quotas, got %#v", role.Quotas.Network)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{
+			name: "existing project",
+			data: map[string]interface{}{
+				"project_id": "project123",
+			},
+		},
+		{
+			name: "unknown quota",
+			data: map[string]interface{}{
+				"quotas": `{"compute": {"unicorns": 1}}`,
+			},
+		},
+		{
+			name: "unknown service",
+			data: map[string]interface{}{
+				"quotas": `{"dns": {"zones": 1}}`,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "roleset/preview",
+				Data:      tc.data,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatalf("expected error response, got %#v", resp)
+			}
+		})
+	}
+}
+
+func TestRoleSet_AuthScope(t *testing.T) {
+	t.Parallel()
+
+	cfg := &Config{UserDomainID: "user-domain"}
+
+	tests := []struct {
+		name     string
+		role     RoleSet
+		expected *gophercloud.AuthScope
+	}{
+		{
+			name: "default scope",
+		},
+		{
+			name:     "project id",
+			role:     RoleSet{ProjectID: "project123", ProjectDomainID: "ignored"},
+			expected: &gophercloud.AuthScope{ProjectID: "project123"},
+		},
+		{
+			name:     "project name with domain id",
+			role:     RoleSet{ProjectName: "myproject", ProjectDomainID: "project-domain"},
+			expected: &gophercloud.AuthScope{ProjectName: "myproject", DomainID: "project-domain"},
+		},
+		{
+			name:     "project name with domain name",
+			role:     RoleSet{ProjectName: "myproject", ProjectDomainName: "Projects"},
+			expected: &gophercloud.AuthScope{ProjectName: "myproject", DomainName: "Projects"},
+		},
+		{
+			name:     "project name falls back to user domain",
+			role:     RoleSet{ProjectName: "myproject"},
+			expected: &gophercloud.AuthScope{ProjectName: "myproject", DomainID: "user-domain"},
+		},
+		{
+			name:     "domain",
+			role:     RoleSet{ScopeType: scopeTypeDomain, DomainName: "Customers"},
+			expected: &gophercloud.AuthScope{DomainName: "Customers"},
+		},
+		{
+			name:     "system",
+			role:     RoleSet{ScopeType: scopeTypeSystem},
+			expected: &gophercloud.AuthScope{System: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			scope := tc.role.authScope(cfg)
+			if !reflect.DeepEqual(scope, tc.expected) {
+				t.Errorf("scope = %#v, expected %#v", scope, tc.expected)
+			}
+		})
+	}
+}
+
+func TestRoleSet_ScopeValidation(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		wantErr bool
+	}{
+		{
+			name: "domain scope",
+			data: map[string]interface{}{"scope_type": "domain", "domain_id": "domain123"},
+		},
+		{
+			name: "system scope",
+			data: map[string]interface{}{"scope_type": "system"},
+		},
+		{
+			name:    "domain scope without domain",
+			data:    map[string]interface{}{"scope_type": "domain"},
+			wantErr: true,
+		},
+		{
+			name:    "domain scope with project",
+			data:    map[string]interface{}{"scope_type": "domain", "domain_id": "domain123", "project_id": "project123"},
+			wantErr: true,
+		},
+		{
+			name:    "project scope without project",
+			data:    map[string]interface{}{"scope_type": "project"},
+			wantErr: true,
+		},
+		{
+			name:    "system scope with domain",
+			data:    map[string]interface{}{"scope_type": "system", "domain_name": "Default"},
+			wantErr: true,
+		},
+		{
+			name:    "domain without scope type",
+			data:    map[string]interface{}{"domain_id": "domain123"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown scope type",
+			data:    map[string]interface{}{"scope_type": "galaxy"},
+			wantErr: true,
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := fmt.Sprintf("roleset/scope-%d", i)
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      path,
+				Data:      tc.data,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr {
+				if resp == nil || !resp.IsError() {
+					t.Fatalf("expected error response, got %#v", resp)
+				}
+				return
+			}
+			if resp != nil && resp.IsError() {
+				t.Fatal(resp.Error())
+			}
+
+			resp, err = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      path,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data["scope_type"] != tc.data["scope_type"] {
+				t.Errorf("scope_type = %v, expected %v", resp.Data["scope_type"], tc.data["scope_type"])
+			}
+		})
+	}
+}
+
+func TestRoleSet_Verify(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url":       ks.URL + "/v3",
+			"username":       "svc",
+			"user_domain_id": "default",
+			"password":       "secret",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected verified config, got %#v", resp)
+	}
+	if resp.Data["user_name"] != "svc" || resp.Data["project_id"] != "project123" {
+		t.Errorf("unexpected verification response: %v", resp.Data)
+	}
+
+	// Names are resolved to IDs and the roleset's project is stored by ID
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/member",
+		Data: map[string]interface{}{
+			"project_name": "myproject",
+			"roles":        `[{"name": "member"}, {"id": "role-admin"}]`,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || len(resp.Warnings) != 1 || !strings.Contains(resp.Warnings[0], `"admin"`) {
+		t.Fatalf("expected a warning about delegating admin, got %#v", resp)
+	}
+
+	role, err := b.(*backend).Role(context.Background(), reqStorage, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ResolvedProjectID != "project123" {
+		t.Errorf("ResolvedProjectID = %q, expected %q", role.ResolvedProjectID, "project123")
+	}
+	expectedRoles := []applicationcredentials.Role{
+		{ID: "role-member", Name: "member"},
+		{ID: "role-admin", Name: "admin"},
+	}
+	if !reflect.DeepEqual(role.Roles, expectedRoles) {
+		t.Errorf("Roles = %#v, expected %#v", role.Roles, expectedRoles)
+	}
+
+	for _, roles := range []string{`[{"name": "unknown"}]`, `[{"id": "role-unknown"}]`} {
+		resp, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roleset/member",
+			Data:      map[string]interface{}{"roles": roles},
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Errorf("expected error response for roles %s, got %#v", roles, resp)
+		}
+	}
+
+	// Verification can be skipped
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/member",
+		Data: map[string]interface{}{
+			"roles":             `[{"name": "unknown"}]`,
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+}
+
+func TestRoleSet_ChangeProjectByName(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	request := func(path string, data map[string]interface{}) {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+	request(configAccessKey, map[string]interface{}{
+		"auth_url":       ks.URL + "/v3",
+		"username":       "svc",
+		"user_domain_id": "default",
+		"password":       "secret",
+	})
+	request("roleset/member", map[string]interface{}{
+		"project_name": "myproject",
+		"roles":        "member",
+	})
+
+	// The project ID resolved for the previous name doesn't override the
+	// new one
+	request("roleset/member", map[string]interface{}{
+		"project_name": "otherproject",
+	})
+
+	role, err := b.(*backend).Role(context.Background(), reqStorage, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role.ProjectID != "" || role.ProjectName != "otherproject" {
+		t.Errorf("project = %q (%q), expected the name %q", role.ProjectID, role.ProjectName, "otherproject")
+	}
+	if role.ResolvedProjectID != "project456" || role.ResolvedProjectName != "otherproject" {
+		t.Errorf("resolved project = %q (%q), expected %q (%q)", role.ResolvedProjectID, role.ResolvedProjectName, "project456", "otherproject")
+	}
+	if scope := role.authScope(&Config{}); scope.ProjectID != "" || scope.ProjectName != "otherproject" {
+		t.Errorf("unexpected scope %#v", scope)
+	}
+
+	// A project written without verification isn't resolved
+	request("roleset/member", map[string]interface{}{
+		"project_name":      "myproject",
+		"verify_connection": false,
+	})
+	if role, err = b.(*backend).Role(context.Background(), reqStorage, "member"); err != nil {
+		t.Fatal(err)
+	}
+	if role.ProjectName != "myproject" || role.ResolvedProjectID != "" {
+		t.Errorf("project = %q, resolved to %q, expected %q unresolved", role.ProjectName, role.ResolvedProjectID, "myproject")
+	}
+}
+
+func TestRoleSet_RolesFormats(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		data     map[string]interface{}
+		expected []applicationcredentials.Role
+	}{
+		{
+			name: "json string",
+			data: map[string]interface{}{"roles": `[{"id": "role123"}, {"name": "member", "domain_id": "default"}]`},
+			expected: []applicationcredentials.Role{
+				{ID: "role123"},
+				{Name: "member", DomainID: "default"},
+			},
+		},
+		{
+			name: "comma-separated names",
+			data: map[string]interface{}{"roles": "member, reader"},
+			expected: []applicationcredentials.Role{
+				{Name: "member"},
+				{Name: "reader"},
+			},
+		},
+		{
+			name: "list of names",
+			data: map[string]interface{}{"roles": []interface{}{"member", "reader", "member"}},
+			expected: []applicationcredentials.Role{
+				{Name: "member"},
+				{Name: "reader"},
+			},
+		},
+		{
+			name: "list of maps",
+			data: map[string]interface{}{"roles": []interface{}{
+				map[string]interface{}{"id": "role123"},
+				map[string]interface{}{"name": "member"},
+			}},
+			expected: []applicationcredentials.Role{
+				{ID: "role123"},
+				{Name: "member"},
+			},
+		},
+		{
+			name: "role ids",
+			data: map[string]interface{}{"roles": "member", "role_ids": "role123,role456"},
+			expected: []applicationcredentials.Role{
+				{Name: "member"},
+				{ID: "role123"},
+				{ID: "role456"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			b, reqStorage := getTestBackend(t)
+
+			tt.data["verify_connection"] = false
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      "roleset/test",
+				Data:      tt.data,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp != nil && resp.IsError() {
+				t.Fatal(resp.Error())
+			}
+
+			resp, err = b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "roleset/test",
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(resp.Data["roles"], tt.expected) {
+				t.Errorf("roles = %#v, expected %#v", resp.Data["roles"], tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoleSet_InvalidRole(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"roles": []interface{}{map[string]interface{}{"role": "member"}},
+		},
+		Storage: reqStorage,
+	})
+	if err == nil {
+		t.Fatal("expected error for unknown role key")
+	}
+}
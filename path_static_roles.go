@@ -0,0 +1,410 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	staticRolePrefix = "static-roles/"
+
+	staticRolePasswordLength = 32
+
+	// minStaticRotationPeriod keeps the periodic function, which runs about
+	// once a minute, from rotating a password on every tick.
+	minStaticRotationPeriod = 5 * time.Minute
+)
+
+func pathListStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList,
+		},
+	}
+}
+
+func pathStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: staticRolePrefix + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+			"user_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the existing Keystone user whose password is managed",
+			},
+			"cloud": {
+				Type:        framework.TypeString,
+				Description: "Name of the config/cloud entry the user lives in; defaults to config/auth",
+			},
+			"rotation_period": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Interval at which the user's password is rotated",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead,
+			logical.CreateOperation: b.pathStaticRoleWrite,
+			logical.UpdateOperation: b.pathStaticRoleWrite,
+			logical.DeleteOperation: b.pathStaticRoleDelete,
+		},
+		ExistenceCheck:  b.staticRoleExistenceCheck,
+		HelpSynopsis:    pathStaticRolesHelpSyn,
+		HelpDescription: pathStaticRolesHelpDesc,
+	}
+}
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the static role",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead,
+		},
+	}
+}
+
+func (b *backend) staticRoleExistenceCheck(ctx context.Context, req *logical.Request, d *framework.FieldData) (bool, error) {
+	role, err := b.staticRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return role != nil, nil
+}
+
+func (b *backend) staticRole(ctx context.Context, storage logical.Storage, name string) (*staticRole, error) {
+	if name == "" {
+		return nil, errors.New("invalid static role name")
+	}
+
+	entry, err := storage.Get(ctx, staticRolePrefix+name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving static role: %w", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	result := &staticRole{}
+	if err := entry.DecodeJSON(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *backend) pathStaticRoleList(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List(ctx, staticRolePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticRoleRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.staticRole(ctx, req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"user_id":             role.UserID,
+			"username":            role.Username,
+			"cloud":               role.Cloud,
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"last_vault_rotation": role.LastVaultRotation.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (b *backend) pathStaticRoleWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	role, err := b.staticRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	create := role == nil
+	if create {
+		role = &staticRole{}
+	}
+
+	if userID, ok := d.GetOk("user_id"); ok {
+		if !create && userID.(string) != role.UserID {
+			return logical.ErrorResponse("user_id cannot be changed on an existing static role"), nil
+		}
+		role.UserID = userID.(string)
+	}
+	if cloud, ok := d.GetOk("cloud"); ok {
+		if !create && cloud.(string) != role.Cloud {
+			return logical.ErrorResponse("cloud cannot be changed on an existing static role"), nil
+		}
+		role.Cloud = cloud.(string)
+	}
+	if rotationPeriod, ok := d.GetOk("rotation_period"); ok {
+		role.RotationPeriod = time.Duration(rotationPeriod.(int)) * time.Second
+	}
+
+	if role.UserID == "" {
+		return logical.ErrorResponse("user_id is required"), nil
+	}
+	if role.RotationPeriod < minStaticRotationPeriod {
+		return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %s", minStaticRotationPeriod)), nil
+	}
+
+	if !create {
+		if err := storeStaticRole(ctx, req.Storage, name, role); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	cfg, err := b.configForRole(ctx, req.Storage, &RoleSet{Cloud: role.Cloud})
+	if err != nil {
+		return nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("access config not found"), nil
+	}
+
+	identityClient, err := b.cachedClient(ctx, cfg, &RoleSet{})
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	if rootUserID, err := authenticatedUserID(identityClient); err == nil && rootUserID == role.UserID {
+		return logical.ErrorResponse("the configured OpenStack user is managed with config/rotate-root"), nil
+	}
+
+	user, err := users.Get(ctx, identityClient, role.UserID).Extract()
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error retrieving user %q: %s", role.UserID, err)), nil
+	}
+	role.Username = user.Name
+	role.UserDomainID = user.DomainID
+
+	// Take ownership of the password right away so that only Vault knows it.
+	if err := b.rotateStaticRole(ctx, req.Storage, name, role); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleDelete(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	if err := req.Storage.Delete(ctx, staticRolePrefix+d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathStaticCredsRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.staticRole(ctx, req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("static role %q not found", name)), nil
+	}
+
+	// The stored password may not be the one Keystone has if the last
+	// rotation didn't finish, so the rotation is completed first.
+	if role.PendingPassword != "" {
+		if role, err = b.completeStaticRotation(ctx, req.Storage, name); err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("static role %q not found", name)), nil
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"user_id":             role.UserID,
+			"username":            role.Username,
+			"user_domain_id":      role.UserDomainID,
+			"password":            role.Password,
+			"last_vault_rotation": role.LastVaultRotation.Format(time.RFC3339),
+			"rotation_period":     int64(role.RotationPeriod.Seconds()),
+			"ttl":                 int64(time.Until(role.NextRotation()).Seconds()),
+		},
+	}, nil
+}
+
+// completeStaticRotation rotates the static role again if its last rotation
+// left a pending password behind, and returns the role.
+func (b *backend) completeStaticRotation(ctx context.Context, storage logical.Storage, name string) (*staticRole, error) {
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	role, err := b.staticRole(ctx, storage, name)
+	if err != nil || role == nil || role.PendingPassword == "" {
+		return role, err
+	}
+	if err := b.rotateStaticRole(ctx, storage, name, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// rotateStaticRole sets a new generated password on the role's user and
+// stores it. The password is stored as pending before it is set, so that it
+// isn't lost if it can't be stored once Keystone has it; a role left with a
+// pending password is rotated again before its password is served. The
+// caller must hold staticRoleLock.
+func (b *backend) rotateStaticRole(ctx context.Context, storage logical.Storage, name string, role *staticRole) error {
+	cfg, err := b.configForRole(ctx, storage, &RoleSet{Cloud: role.Cloud})
+	if err != nil {
+		return fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return errors.New("access config not found")
+	}
+
+	identityClient, err := b.cachedClient(ctx, cfg, &RoleSet{})
+	if err != nil {
+		return fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	password, err := newPassword()
+	if err != nil {
+		return err
+	}
+
+	role.PendingPassword = password
+	if err := storeStaticRole(ctx, storage, name, role); err != nil {
+		return fmt.Errorf("error storing pending password: %w", err)
+	}
+
+	if err := setPassword(ctx, identityClient, role.UserID, password); err != nil {
+		return err
+	}
+
+	role.Password = password
+	role.PendingPassword = ""
+	role.LastVaultRotation = time.Now()
+	if err := storeStaticRole(ctx, storage, name, role); err != nil {
+		b.Logger().Error("static role password was changed in Keystone but is only stored as pending", "role", name, "error", err)
+		return fmt.Errorf("password was changed but could not be stored: %w", err)
+	}
+
+	return nil
+}
+
+// rotateDueStaticRoles rotates the passwords of all static roles whose
+// rotation period has passed.
+func (b *backend) rotateDueStaticRoles(ctx context.Context, storage logical.Storage) error {
+	names, err := storage.List(ctx, staticRolePrefix)
+	if err != nil {
+		return err
+	}
+
+	b.staticRoleLock.Lock()
+	defer b.staticRoleLock.Unlock()
+
+	var errs error
+	for _, name := range names {
+		role, err := b.staticRole(ctx, storage, name)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// Roles whose last rotation didn't finish are rotated again right
+		// away.
+		if role == nil || (role.PendingPassword == "" && time.Now().Before(role.NextRotation())) {
+			continue
+		}
+
+		if err := b.rotateStaticRole(ctx, storage, name, role); err != nil {
+			b.Logger().Error("static role rotation failed", "role", name, "error", err)
+			errs = errors.Join(errs, fmt.Errorf("static role %q: %w", name, err))
+			continue
+		}
+		b.Logger().Info("rotated static role password", "role", name)
+	}
+
+	return errs
+}
+
+// newPassword generates a password for a user managed by Vault.
+func newPassword() (string, error) {
+	password, err := base62.Random(staticRolePasswordLength)
+	if err != nil {
+		return "", fmt.Errorf("error generating password: %w", err)
+	}
+	return password, nil
+}
+
+// setPassword sets the password of the user.
+func setPassword(ctx context.Context, identityClient *gophercloud.ServiceClient, userID, password string) error {
+	if _, err := users.Update(ctx, identityClient, userID, users.UpdateOpts{
+		Password: password,
+	}).Extract(); err != nil {
+		return fmt.Errorf("error updating password of user %q: %w", userID, err)
+	}
+	return nil
+}
+
+func storeStaticRole(ctx context.Context, storage logical.Storage, name string, role *staticRole) error {
+	entry, err := logical.StorageEntryJSON(staticRolePrefix+name, role)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+type staticRole struct {
+	UserID            string        `json:"user_id"`
+	Username          string        `json:"username"`
+	UserDomainID      string        `json:"user_domain_id,omitempty"`
+	Cloud             string        `json:"cloud,omitempty"`
+	RotationPeriod    time.Duration `json:"rotation_period"`
+	Password          string        `json:"password"`
+	LastVaultRotation time.Time     `json:"last_vault_rotation"`
+
+	// PendingPassword holds the password a rotation is switching to until
+	// it has been set in Keystone.
+	PendingPassword string `json:"pending_password,omitempty"`
+}
+
+// NextRotation returns when the static role's password is next rotated.
+func (r *staticRole) NextRotation() time.Time {
+	return r.LastVaultRotation.Add(r.RotationPeriod)
+}
+
+var pathStaticRolesHelpSyn = "Manage the password of an existing Keystone user"
+
+var pathStaticRolesHelpDesc = `
+Binds an existing Keystone user to Vault. The user's password is rotated as
+soon as the static role is created and then every rotation_period. The current
+password is served from static-creds/<name>.
+`
@@ -0,0 +1,234 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestStaticRole_Validation(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+	}{
+		{
+			name: "missing user_id",
+			data: map[string]interface{}{"rotation_period": "24h"},
+		},
+		{
+			name: "missing rotation_period",
+			data: map[string]interface{}{"user_id": "user123"},
+		},
+		{
+			name: "rotation_period too short",
+			data: map[string]interface{}{"user_id": "user123", "rotation_period": "1m"},
+		},
+		{
+			name: "without access config",
+			data: map[string]interface{}{"user_id": "user123", "rotation_period": "24h"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, reqStorage := getTestBackend(t)
+
+			resp, err := b.HandleRequest(context.Background(), &logical.Request{
+				Operation: logical.CreateOperation,
+				Path:      staticRolePrefix + "service",
+				Data:      tc.data,
+				Storage:   reqStorage,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp == nil || !resp.IsError() {
+				t.Fatal("expected error response")
+			}
+		})
+	}
+}
+
+func TestStaticRole_ReadAndUpdate(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	lastRotation := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := storeStaticRole(context.Background(), reqStorage, "service", &staticRole{
+		UserID:            "user123",
+		Username:          "service",
+		RotationPeriod:    24 * time.Hour,
+		Password:          "secret",
+		LastVaultRotation: lastRotation,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      staticRolePrefix + "service",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["user_id"] != "user123" {
+		t.Errorf("expected user_id=user123, got %v", resp.Data["user_id"])
+	}
+	if _, ok := resp.Data["password"]; ok {
+		t.Error("password should not be returned from static-roles")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/service",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["password"] != "secret" {
+		t.Errorf("expected password=secret, got %v", resp.Data["password"])
+	}
+	ttl := resp.Data["ttl"].(int64)
+	if ttl <= int64((22*time.Hour).Seconds()) || ttl > int64((23*time.Hour).Seconds()) {
+		t.Errorf("expected ttl of about 23h, got %v", ttl)
+	}
+
+	// The bound user cannot be changed
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      staticRolePrefix + "service",
+		Data:      map[string]interface{}{"user_id": "other"},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response when changing user_id")
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      staticRolePrefix + "service",
+		Data:      map[string]interface{}{"rotation_period": "48h"},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "static-roles/",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "service" {
+		t.Errorf("expected [service], got %v", keys)
+	}
+}
+
+func TestStaticCreds_NotFound(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/missing",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error response for missing static role")
+	}
+}
+
+func TestStaticRole_PendingPassword(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// A password Keystone refuses stays pending, and the stored password is
+	// left alone.
+	role := &staticRole{
+		UserID:            "missing",
+		RotationPeriod:    24 * time.Hour,
+		Password:          "old",
+		LastVaultRotation: time.Now(),
+	}
+	if err := b.(*backend).rotateStaticRole(context.Background(), reqStorage, "missing", role); err == nil {
+		t.Fatal("expected the rotation to fail")
+	}
+	stored, err := b.(*backend).staticRole(context.Background(), reqStorage, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "old" || stored.PendingPassword == "" {
+		t.Errorf("expected the new password to be pending, got %#v", stored)
+	}
+
+	// A role left with a pending password is rotated again before its
+	// password is served.
+	if err := storeStaticRole(context.Background(), reqStorage, "service", &staticRole{
+		UserID:            "user456",
+		RotationPeriod:    24 * time.Hour,
+		Password:          "old",
+		PendingPassword:   "interrupted",
+		LastVaultRotation: time.Now(),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "static-creds/service",
+		Storage:   reqStorage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+	if n := ks.passwordUpdates.Load(); n != 1 {
+		t.Errorf("expected the password to be rotated, got %d updates", n)
+	}
+	if password := resp.Data["password"]; password == "old" || password == "interrupted" {
+		t.Errorf("expected a new password, got %v", password)
+	}
+	if stored, err = b.(*backend).staticRole(context.Background(), reqStorage, "service"); err != nil {
+		t.Fatal(err)
+	}
+	if stored.PendingPassword != "" || stored.Password != resp.Data["password"] {
+		t.Errorf("expected the new password to be stored, got %#v", stored)
+	}
+}
@@ -0,0 +1,538 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	issuedCredentialPrefix = "credential/"
+	credentialTrackingKey  = "tidy/tracking"
+	autoTidyConfigKey      = "config/auto-tidy"
+
+	defaultAutoTidyInterval = 12 * time.Hour
+
+	// tidySafetyBuffer skips credentials that may still be in the middle of
+	// being issued; those are covered by the WAL rollback instead.
+	tidySafetyBuffer = walRollbackMinAge
+
+	tidyStateInactive = "Inactive"
+	tidyStateRunning  = "Running"
+	tidyStateFinished = "Finished"
+	tidyStateError    = "Error"
+)
+
+// issuedCredential tracks an application credential for as long as its lease
+// is live, so that tidy can tell vault-created credentials that lost their
+// lease apart from those still in use.
+type issuedCredential struct {
+	RoleSet   string    `json:"roleset"`
+	Cloud     string    `json:"cloud,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// credentialTracking records when issued credentials started being tracked
+// and the ID of this mount. Credentials created before then have no record
+// even if their lease is still live. The mount ID tags the description of
+// every application credential the mount issues, so that tidy never touches
+// credentials issued by other mounts sharing the same Keystone user.
+type credentialTracking struct {
+	Since   time.Time `json:"since"`
+	MountID string    `json:"mount_id,omitempty"`
+}
+
+// tag returns the marker in the description of the application credentials
+// issued by this mount.
+func (t *credentialTracking) tag() string {
+	return "[vault-mount:" + t.MountID + "]"
+}
+
+type tidyStray struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Cloud string `json:"cloud"`
+}
+
+type tidyStatus struct {
+	State        string
+	DryRun       bool
+	StartTime    time.Time
+	EndTime      time.Time
+	Error        string
+	Strays       []tidyStray
+	DeletedCount int
+}
+
+type autoTidyConfig struct {
+	Enabled  bool          `json:"enabled"`
+	Interval time.Duration `json:"interval"`
+	DryRun   bool          `json:"dry_run"`
+}
+
+func pathTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy$",
+		Fields: map[string]*framework.FieldSchema{
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "Report stray application credentials without deleting them",
+				Default:     false,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathTidyUpdate,
+		},
+		HelpSynopsis:    pathTidyHelpSyn,
+		HelpDescription: pathTidyHelpDesc,
+	}
+}
+
+func pathTidyStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTidyStatusRead,
+		},
+	}
+}
+
+func pathConfigAutoTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: autoTidyConfigKey,
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": {
+				Type:        framework.TypeBool,
+				Description: "Run tidy periodically",
+			},
+			"interval": {
+				Type:        framework.TypeDurationSecond,
+				Description: "Interval between automatic tidy runs",
+				Default:     int(defaultAutoTidyInterval.Seconds()),
+			},
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "Only report stray application credentials during automatic tidy runs",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigAutoTidyRead,
+			logical.UpdateOperation: b.pathConfigAutoTidyWrite,
+		},
+	}
+}
+
+func (b *backend) putIssuedCredential(ctx context.Context, storage logical.Storage, id string, credential *issuedCredential) error {
+	entry, err := logical.StorageEntryJSON(issuedCredentialPrefix+id, credential)
+	if err != nil {
+		return err
+	}
+	return storage.Put(ctx, entry)
+}
+
+// getCredentialTracking returns the credential tracking of the mount,
+// starting it now if this is the first time it is asked.
+func (b *backend) getCredentialTracking(ctx context.Context, storage logical.Storage) (*credentialTracking, error) {
+	entry, err := storage.Get(ctx, credentialTrackingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tracking := &credentialTracking{}
+	if entry != nil {
+		if err := entry.DecodeJSON(tracking); err != nil {
+			return nil, fmt.Errorf("error reading credential tracking: %w", err)
+		}
+		if tracking.MountID != "" {
+			return tracking, nil
+		}
+	} else {
+		tracking.Since = time.Now()
+	}
+
+	// Mounts tracking credentials from before they were tagged get a mount
+	// ID now; the credentials they issued before are never tidied.
+	if tracking.MountID, err = uuid.GenerateUUID(); err != nil {
+		return nil, err
+	}
+	entry, err = logical.StorageEntryJSON(credentialTrackingKey, tracking)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return tracking, nil
+}
+
+// issuedCredentialDescription returns the description of an application
+// credential issued by this mount, carrying the mount's tag.
+func (b *backend) issuedCredentialDescription(ctx context.Context, storage logical.Storage) (string, error) {
+	tracking, err := b.getCredentialTracking(ctx, storage)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Created by Vault at %s %s", time.Now().Format(time.RFC3339), tracking.tag()), nil
+}
+
+func (b *backend) pathTidyUpdate(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if !b.startTidy(req.Storage, d.Get("dry_run").(bool)) {
+		resp := &logical.Response{}
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs and reported by tidy-status.")
+	return logical.RespondWithStatusCode(resp, req, http.StatusAccepted)
+}
+
+func (b *backend) pathTidyStatusRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.tidyStatusLock.RLock()
+	defer b.tidyStatusLock.RUnlock()
+
+	data := map[string]interface{}{
+		"state":         b.tidyStatus.State,
+		"dry_run":       b.tidyStatus.DryRun,
+		"error":         b.tidyStatus.Error,
+		"strays":        b.tidyStatus.Strays,
+		"deleted_count": b.tidyStatus.DeletedCount,
+		"time_started":  nil,
+		"time_finished": nil,
+	}
+	if !b.tidyStatus.StartTime.IsZero() {
+		data["time_started"] = b.tidyStatus.StartTime.Format(time.RFC3339)
+	}
+	if !b.tidyStatus.EndTime.IsZero() {
+		data["time_finished"] = b.tidyStatus.EndTime.Format(time.RFC3339)
+	}
+
+	return &logical.Response{Data: data}, nil
+}
+
+func (b *backend) readAutoTidyConfig(ctx context.Context, storage logical.Storage) (*autoTidyConfig, error) {
+	entry, err := storage.Get(ctx, autoTidyConfigKey)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := &autoTidyConfig{Interval: defaultAutoTidyInterval}
+	if entry == nil {
+		return conf, nil
+	}
+	if err := entry.DecodeJSON(conf); err != nil {
+		return nil, fmt.Errorf("error reading auto-tidy configuration: %w", err)
+	}
+
+	return conf, nil
+}
+
+func (b *backend) pathConfigAutoTidyRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := b.readAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":  conf.Enabled,
+			"interval": int64(conf.Interval.Seconds()),
+			"dry_run":  conf.DryRun,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigAutoTidyWrite(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	conf, err := b.readAutoTidyConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled, ok := d.GetOk("enabled"); ok {
+		conf.Enabled = enabled.(bool)
+	}
+	if interval, ok := d.GetOk("interval"); ok {
+		conf.Interval = time.Duration(interval.(int)) * time.Second
+	}
+	if dryRun, ok := d.GetOk("dry_run"); ok {
+		conf.DryRun = dryRun.(bool)
+	}
+	if conf.Interval <= 0 {
+		return logical.ErrorResponse("interval must be greater than zero"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON(autoTidyConfigKey, conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(ctx, entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// autoTidy starts a tidy run if automatic tidying is enabled and the interval
+// since the previous automatic run has passed.
+func (b *backend) autoTidy(ctx context.Context, storage logical.Storage) error {
+	conf, err := b.readAutoTidyConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if !conf.Enabled {
+		return nil
+	}
+
+	b.tidyStatusLock.RLock()
+	lastAutoTidy := b.lastAutoTidy
+	b.tidyStatusLock.RUnlock()
+	if time.Since(lastAutoTidy) < conf.Interval {
+		return nil
+	}
+
+	if b.startTidy(storage, conf.DryRun) {
+		b.tidyStatusLock.Lock()
+		b.lastAutoTidy = time.Now()
+		b.tidyStatusLock.Unlock()
+	}
+
+	return nil
+}
+
+// startTidy runs tidy in the background and reports whether it was started;
+// only one tidy runs at a time.
+func (b *backend) startTidy(storage logical.Storage, dryRun bool) bool {
+	if !b.tidyRunning.CompareAndSwap(false, true) {
+		return false
+	}
+
+	b.tidyStatusLock.Lock()
+	b.tidyStatus = &tidyStatus{
+		State:     tidyStateRunning,
+		DryRun:    dryRun,
+		StartTime: time.Now(),
+	}
+	b.tidyStatusLock.Unlock()
+
+	go func() {
+		defer b.tidyRunning.Store(false)
+
+		strays, deleted, err := b.tidyApplicationCredentials(context.Background(), storage, dryRun)
+
+		b.tidyStatusLock.Lock()
+		defer b.tidyStatusLock.Unlock()
+
+		b.tidyStatus.EndTime = time.Now()
+		b.tidyStatus.Strays = strays
+		b.tidyStatus.DeletedCount = deleted
+		if err != nil {
+			b.tidyStatus.State = tidyStateError
+			b.tidyStatus.Error = err.Error()
+			b.Logger().Error("tidy failed", "error", err)
+			return
+		}
+		b.tidyStatus.State = tidyStateFinished
+		b.Logger().Info("tidy finished", "strays", len(strays), "deleted", deleted, "dry_run", dryRun)
+	}()
+
+	return true
+}
+
+// tidyTarget is a Keystone user whose application credentials are swept.
+type tidyTarget struct {
+	cloud          string
+	identityClient *gophercloud.ServiceClient
+	userID         string
+}
+
+// tidyApplicationCredentials finds vault-created application credentials
+// that are expired or no longer backed by a lease and, unless dryRun is set,
+// deletes them. It returns the strays found and how many were deleted.
+func (b *backend) tidyApplicationCredentials(ctx context.Context, storage logical.Storage, dryRun bool) ([]tidyStray, int, error) {
+	tracking, err := b.getCredentialTracking(ctx, storage)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	clouds, err := storage.List(ctx, configCloudPrefix)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var targets []tidyTarget
+	var errs error
+	seen := make(map[string]bool)
+	// Credentials Vault authenticates with, or is rotating to, must never be
+	// swept, even when another configuration shares the same Keystone user
+	// and whether or not that configuration authenticates right now.
+	protectedIDs := make(map[string]bool)
+	protectedNames := make(map[string]bool)
+
+	cloudConfigs := make(map[string]*Config)
+	for _, cloud := range append([]string{""}, clouds...) {
+		cfg, err := b.configForRole(ctx, storage, &RoleSet{Cloud: cloud})
+		if err != nil {
+			// The credentials of a config that can't be read can't be
+			// protected, so nothing is swept.
+			return nil, 0, fmt.Errorf("cloud %q: %w", cloud, err)
+		}
+		if cfg == nil {
+			continue
+		}
+		cloudConfigs[cloud] = cfg
+
+		if cfg.ApplicationCredentialID != "" {
+			protectedIDs[cfg.ApplicationCredentialID] = true
+		}
+		if cfg.ApplicationCredentialName != "" {
+			protectedNames[cfg.ApplicationCredentialName] = true
+		}
+		if cfg.PendingApplicationCredential != nil {
+			protectedNames[cfg.PendingApplicationCredential.Name] = true
+		}
+	}
+
+	for _, cloud := range append([]string{""}, clouds...) {
+		cfg, ok := cloudConfigs[cloud]
+		if !ok {
+			continue
+		}
+
+		identityClient, err := b.cachedClient(ctx, cfg, &RoleSet{})
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("cloud %q: %w", cloud, err))
+			continue
+		}
+		userID, err := authenticatedUserID(identityClient)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("cloud %q: %w", cloud, err))
+			continue
+		}
+
+		key := cfg.AuthURL + "|" + userID
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		targets = append(targets, tidyTarget{cloud: cloud, identityClient: identityClient, userID: userID})
+	}
+
+	var strays []tidyStray
+	deleted := 0
+	for _, target := range targets {
+		pages, err := applicationcredentials.List(target.identityClient, target.userID, nil).AllPages(ctx)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("cloud %q: error listing application credentials: %w", target.cloud, err))
+			continue
+		}
+		credentials, err := applicationcredentials.ExtractApplicationCredentials(pages)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+
+		for _, credential := range credentials {
+			if protectedIDs[credential.ID] || protectedNames[credential.Name] {
+				continue
+			}
+
+			stray, err := isStrayCredential(ctx, storage, credential, tracking)
+			if err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if !stray {
+				continue
+			}
+
+			strays = append(strays, tidyStray{ID: credential.ID, Name: credential.Name, Cloud: target.cloud})
+			if dryRun {
+				continue
+			}
+
+			if err := applicationcredentials.Delete(ctx, target.identityClient, target.userID, credential.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+				errs = errors.Join(errs, fmt.Errorf("error deleting application credential %q: %w", credential.ID, err))
+				continue
+			}
+			if err := storage.Delete(ctx, issuedCredentialPrefix+credential.ID); err != nil {
+				errs = errors.Join(errs, err)
+			}
+			deleted++
+		}
+	}
+
+	return strays, deleted, errs
+}
+
+// isStrayCredential reports whether credential was issued by this mount and
+// is either expired or not tracked by a live lease. Credentials created
+// before tracking started were never tracked, so they are only stray once
+// expired.
+func isStrayCredential(ctx context.Context, storage logical.Storage, credential applicationcredentials.ApplicationCredential, tracking *credentialTracking) (bool, error) {
+	if !strings.Contains(credential.Description, tracking.tag()) {
+		return false, nil
+	}
+	createdAt, ok := vaultCredentialCreatedAt(credential.Name)
+	if !ok {
+		return false, nil
+	}
+	if time.Since(createdAt) < tidySafetyBuffer {
+		return false, nil
+	}
+
+	if !credential.ExpiresAt.IsZero() && credential.ExpiresAt.Before(time.Now()) {
+		return true, nil
+	}
+	if createdAt.Before(tracking.Since) {
+		return false, nil
+	}
+
+	entry, err := storage.Get(ctx, issuedCredentialPrefix+credential.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return entry == nil, nil
+}
+
+// vaultCredentialCreatedAt parses the creation time from the name of an
+// application credential created by Vault, "vault-<...>-<unix ms>".
+func vaultCredentialCreatedAt(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, "vault-") {
+		return time.Time{}, false
+	}
+
+	idx := strings.LastIndex(name, "-")
+	ms, err := strconv.ParseInt(name[idx+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.UnixMilli(ms), true
+}
+
+var pathTidyHelpSyn = "Delete application credentials created by Vault that no longer have a lease"
+
+var pathTidyHelpDesc = `
+Lists the application credentials of every configured OpenStack user and
+deletes those issued by this mount that have expired or are no longer backed
+by a lease, for example after a lease was lost or a snapshot was restored.
+Only credentials whose description carries the mount's tag are considered, so
+credentials issued by other mounts or created by hand are left alone, as are
+the root credentials of every config. Credentials issued before this version
+of the plugin started tracking its leases are never deleted. Use dry_run to
+only report them. The progress of the last run is available from
+tidy-status. Automatic runs can be enabled with config/auto-tidy.
+`
@@ -0,0 +1,402 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestVaultCredentialCreatedAt(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		credName string
+		expected time.Time
+		ok       bool
+	}{
+		{
+			name:     "issued credential",
+			credName: "vault-member-token-1674140730969",
+			expected: time.UnixMilli(1674140730969),
+			ok:       true,
+		},
+		{
+			name:     "pooled credential",
+			credName: "vault-member-pool0-1674140730969",
+			expected: time.UnixMilli(1674140730969),
+			ok:       true,
+		},
+		{
+			name:     "root credential",
+			credName: "vault-root-1674140730969",
+			expected: time.UnixMilli(1674140730969),
+			ok:       true,
+		},
+		{
+			name:     "not created by vault",
+			credName: "terraform-1674140730969",
+			ok:       false,
+		},
+		{
+			name:     "no timestamp",
+			credName: "vault-manual",
+			ok:       false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			createdAt, ok := vaultCredentialCreatedAt(tc.credName)
+			if ok != tc.ok {
+				t.Fatalf("ok = %v, expected %v", ok, tc.ok)
+			}
+			if !createdAt.Equal(tc.expected) {
+				t.Errorf("createdAt = %v, expected %v", createdAt, tc.expected)
+			}
+		})
+	}
+}
+
+func TestIsStrayCredential(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	old := time.Now().Add(-time.Hour).UnixMilli()
+	legacy := time.Now().Add(-3 * time.Hour).UnixMilli()
+	tracking := &credentialTracking{Since: time.Now().Add(-2 * time.Hour), MountID: "mount-a"}
+	tagged := "Created by Vault " + tracking.tag()
+	if err := b.(*backend).putIssuedCredential(context.Background(), reqStorage, "tracked", &issuedCredential{RoleSet: "member"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		credential applicationcredentials.ApplicationCredential
+		expected   bool
+	}{
+		{
+			name:       "tracked",
+			credential: applicationcredentials.ApplicationCredential{ID: "tracked", Name: fmt.Sprintf("vault-member-token-%d", old), Description: tagged},
+			expected:   false,
+		},
+		{
+			name:       "untracked",
+			credential: applicationcredentials.ApplicationCredential{ID: "untracked", Name: fmt.Sprintf("vault-member-token-%d", old), Description: tagged},
+			expected:   true,
+		},
+		{
+			name: "tracked but expired",
+			credential: applicationcredentials.ApplicationCredential{
+				ID:          "tracked",
+				Name:        fmt.Sprintf("vault-member-token-%d", old),
+				Description: tagged,
+				ExpiresAt:   time.Now().Add(-time.Minute),
+			},
+			expected: true,
+		},
+		{
+			name:       "untracked from before tracking",
+			credential: applicationcredentials.ApplicationCredential{ID: "untracked", Name: fmt.Sprintf("vault-member-token-%d", legacy), Description: tagged},
+			expected:   false,
+		},
+		{
+			name: "expired from before tracking",
+			credential: applicationcredentials.ApplicationCredential{
+				ID:          "untracked",
+				Name:        fmt.Sprintf("vault-member-token-%d", legacy),
+				Description: tagged,
+				ExpiresAt:   time.Now().Add(-time.Minute),
+			},
+			expected: true,
+		},
+		{
+			name:       "recently created",
+			credential: applicationcredentials.ApplicationCredential{ID: "untracked", Name: fmt.Sprintf("vault-member-token-%d", time.Now().UnixMilli()), Description: tagged},
+			expected:   false,
+		},
+		{
+			name:       "issued by another mount",
+			credential: applicationcredentials.ApplicationCredential{ID: "untracked", Name: fmt.Sprintf("vault-member-token-%d", old), Description: "Created by Vault [vault-mount:mount-b]"},
+			expected:   false,
+		},
+		{
+			name: "expired without a tag",
+			credential: applicationcredentials.ApplicationCredential{
+				ID:        "untracked",
+				Name:      fmt.Sprintf("vault-member-token-%d", old),
+				ExpiresAt: time.Now().Add(-time.Minute),
+			},
+			expected: false,
+		},
+		{
+			name:       "not created by vault",
+			credential: applicationcredentials.ApplicationCredential{ID: "untracked", Name: "terraform", Description: tagged},
+			expected:   false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			stray, err := isStrayCredential(context.Background(), reqStorage, tc.credential, tracking)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stray != tc.expected {
+				t.Errorf("stray = %v, expected %v", stray, tc.expected)
+			}
+		})
+	}
+}
+
+func TestTidy_WithoutConfig(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Data:      map[string]interface{}{"dry_run": true},
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("unexpected response: %v", resp)
+	}
+
+	status := waitForTidy(t, b, reqStorage, tidyStateFinished)
+	if status.Data["dry_run"] != true {
+		t.Errorf("dry_run = %v, expected true", status.Data["dry_run"])
+	}
+}
+
+func TestTidy_CredentialsIssuedBeforeTracking(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// Pretend the plugin was upgraded two hours ago. The credential issued
+	// before then still has a live lease but no record; the one issued
+	// since has lost its lease.
+	tracking := &credentialTracking{Since: time.Now().Add(-2 * time.Hour), MountID: "mount-a"}
+	entry, err := logical.StorageEntryJSON(credentialTrackingKey, tracking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reqStorage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+	ks.appCreds.Store("legacy", testAppCred{
+		Name:        fmt.Sprintf("vault-member-token-%d", time.Now().Add(-3*time.Hour).UnixMilli()),
+		Description: "Created by Vault " + tracking.tag(),
+	})
+	ks.appCreds.Store("stray", testAppCred{
+		Name:        fmt.Sprintf("vault-member-token-%d", time.Now().Add(-time.Hour).UnixMilli()),
+		Description: "Created by Vault " + tracking.tag(),
+	})
+
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "tidy",
+		Storage:   reqStorage,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForTidy(t, b, reqStorage, tidyStateFinished)
+
+	if status.Data["deleted_count"] != 1 {
+		t.Errorf("deleted_count = %v, expected 1", status.Data["deleted_count"])
+	}
+	if _, ok := ks.appCreds.Load("legacy"); !ok {
+		t.Error("expected the credential issued before tracking to survive tidy")
+	}
+	if _, ok := ks.appCreds.Load("stray"); ok {
+		t.Error("expected the stray credential to be deleted")
+	}
+}
+
+// TestTidy_ForeignAndRootCredentials checks that tidy leaves alone the
+// credentials of other mounts sharing the Keystone user and the root
+// credentials of every config, including one that fails to authenticate.
+func TestTidy_ForeignAndRootCredentials(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+	password := "secret"
+	ks.password.Store(&password)
+
+	request := func(path string, data map[string]interface{}) {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+	request(configAccessKey, map[string]interface{}{
+		"auth_url":          ks.URL + "/v3",
+		"username":          "svc",
+		"user_domain_id":    "default",
+		"password":          password,
+		"verify_connection": false,
+	})
+	// The same user, authenticating with an application credential that
+	// Keystone rejects during the run.
+	request(configCloudPrefix+"broken", map[string]interface{}{
+		"auth_url":                      ks.URL + "/v3",
+		"application_credential_id":     "root-broken",
+		"application_credential_secret": "wrong",
+		"verify_connection":             false,
+	})
+
+	tracking, err := b.(*backend).getCredentialTracking(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracking.Since = time.Now().Add(-2 * time.Hour)
+	entry, err := logical.StorageEntryJSON(credentialTrackingKey, tracking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reqStorage.Put(context.Background(), entry); err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted root rotation of config/auth
+	cfg, err := b.(*backend).readConfigAccess(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.PendingApplicationCredential = &pendingApplicationCredential{Name: "vault-root-pending", Secret: "pending"}
+	if err := storeConfig(context.Background(), reqStorage, configAccessKey, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("vault-member-token-%d", time.Now().Add(-time.Hour).UnixMilli())
+	ks.appCreds.Store("root-broken", testAppCred{Name: name, Description: "Created by Vault " + tracking.tag()})
+	ks.appCreds.Store("pending", testAppCred{Name: "vault-root-pending", Description: "Created by Vault " + tracking.tag()})
+	ks.appCreds.Store("foreign", testAppCred{Name: name, Description: "Created by Vault [vault-mount:other]"})
+	ks.appCreds.Store("stray", testAppCred{Name: name, Description: "Created by Vault " + tracking.tag()})
+
+	request("tidy", nil)
+	status := waitForTidy(t, b, reqStorage, tidyStateError)
+
+	if status.Data["deleted_count"] != 1 {
+		t.Errorf("deleted_count = %v, expected 1", status.Data["deleted_count"])
+	}
+	for _, id := range []string{"root-broken", "pending", "foreign"} {
+		if _, ok := ks.appCreds.Load(id); !ok {
+			t.Errorf("expected %q to survive tidy", id)
+		}
+	}
+	if _, ok := ks.appCreds.Load("stray"); ok {
+		t.Error("expected the stray credential to be deleted")
+	}
+}
+
+// waitForTidy waits for the running tidy to finish in the expected state and
+// returns its status.
+func waitForTidy(t *testing.T, b logical.Backend, reqStorage logical.Storage, state string) *logical.Response {
+	t.Helper()
+
+	var status *logical.Response
+	for i := 0; i < 100; i++ {
+		var err error
+		status, err = b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "tidy-status",
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status.Data["state"] != tidyStateRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if status.Data["state"] != state {
+		t.Fatalf("state = %v, expected %v (error: %v)", status.Data["state"], state, status.Data["error"])
+	}
+	return status
+}
+
+func TestConfigAutoTidy(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      autoTidyConfigKey,
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["enabled"] != false {
+		t.Errorf("enabled = %v, expected false", resp.Data["enabled"])
+	}
+	if resp.Data["interval"] != int64(defaultAutoTidyInterval.Seconds()) {
+		t.Errorf("interval = %v, expected %v", resp.Data["interval"], int64(defaultAutoTidyInterval.Seconds()))
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      autoTidyConfigKey,
+		Data: map[string]interface{}{
+			"enabled":  true,
+			"interval": "1h",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      autoTidyConfigKey,
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["enabled"] != true {
+		t.Errorf("enabled = %v, expected true", resp.Data["enabled"])
+	}
+	if resp.Data["interval"] != int64(3600) {
+		t.Errorf("interval = %v, expected %v", resp.Data["interval"], int64(3600))
+	}
+}
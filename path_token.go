@@ -0,0 +1,232 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "token/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role set",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathKeystoneTokenRead,
+		},
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func (b *backend) pathKeystoneTokenRead(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	leaseConfig, err := b.LeaseConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
+	}
+
+	role, err := b.Role(ctx, req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %w", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("role %q not found", name)), nil
+	}
+
+	cfg, err := b.configForRole(ctx, req.Storage, role)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access config: %w", err)
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("access config not found"), nil
+	}
+
+	if cfg.UsesApplicationCredential() && role.HasScope() {
+		return logical.ErrorResponse(
+			"cannot use application credential authentication with scoped rolesets; " +
+				"application credentials are bound to their original project",
+		), nil
+	}
+
+	// Access rules can't be attached to a token, so handing one out would
+	// bypass them.
+	if len(role.AccessRules) > 0 {
+		return logical.ErrorResponse("tokens cannot be issued for rolesets with access_rules"), nil
+	}
+
+	return b.issueCountedLease(ctx, req, name, role, func() (*logical.Response, error) {
+		return b.issueKeystoneToken(ctx, name, cfg, role, leaseConfig)
+	})
+}
+
+// issueKeystoneToken authenticates with the roleset's scope and returns the
+// resulting token as a lease.
+func (b *backend) issueKeystoneToken(ctx context.Context, name string, cfg *Config, role *RoleSet, leaseConfig *configLease) (*logical.Response, error) {
+	// Every call to client authenticates anew, so the token belongs to this
+	// lease alone and can be revoked without affecting anything else.
+	identityClient, err := client(ctx, cfg, role)
+	if err != nil {
+		return nil, fmt.Errorf("error creating identity client: %w", err)
+	}
+
+	result, err := authResult(identityClient)
+	if err != nil {
+		return nil, err
+	}
+	token, err := result.ExtractToken()
+	if err != nil {
+		return nil, fmt.Errorf("extract token: %w", err)
+	}
+
+	tokenRoles, err := result.ExtractRoles()
+	if err != nil {
+		return nil, fmt.Errorf("extract roles from token: %w", err)
+	}
+	extra, warning, err := undelegatedRoles(ctx, identityClient, tokenRoles, role.Roles)
+	if err != nil || len(extra) > 0 {
+		if err := tokens.Revoke(ctx, identityClient, token.ID).Err; err != nil {
+			b.Logger().Warn("failed to revoke token", "error", err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return logical.ErrorResponse(fmt.Sprintf(
+			"the configured user holds roles on the project that the roleset does not grant: %v", extra,
+		)), nil
+	}
+
+	catalog, err := result.ExtractServiceCatalog()
+	if err != nil {
+		return nil, fmt.Errorf("extract service catalog: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"token":      token.ID,
+		"expires_at": token.ExpiresAt.Format(time.RFC3339),
+		"auth_url":   cfg.AuthURL,
+		"catalog":    catalog.Entries,
+	}
+	if project, err := result.ExtractProject(); err == nil && project != nil {
+		data["project_id"] = project.ID
+		data["project_name"] = project.Name
+	}
+
+	resp := b.Secret(SecretKeystoneTokenType).Response(data, map[string]interface{}{
+		"token":   token.ID,
+		"roleset": name,
+		"cloud":   role.Cloud,
+	})
+
+	// Keystone tokens can't be extended, so the lease never outlives the
+	// token.
+	ttl, maxTTL := b.leaseTTLs(role, leaseConfig)
+	if remaining := time.Until(token.ExpiresAt); remaining < maxTTL {
+		maxTTL = remaining
+	}
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = maxTTL
+	if warning != "" {
+		resp.AddWarning(warning)
+	}
+
+	return resp, nil
+}
+
+// undelegatedRoles returns the names of the token roles that the roleset
+// neither lists nor implies. Keystone adds the roles implied by a user's
+// roles to their tokens, so the roleset's roles are expanded with the role
+// inference rules first. If the configured user may not list those rules,
+// the token roles can't be checked and a warning is returned instead.
+func undelegatedRoles(ctx context.Context, identityClient *gophercloud.ServiceClient, tokenRoles []tokens.Role, allowed []applicationcredentials.Role) ([]string, string, error) {
+	if len(allowed) == 0 {
+		return nil, "", nil
+	}
+
+	rules, err := roles.ListRoleInferenceRules(ctx, identityClient).Extract()
+	if gophercloud.ResponseCodeIs(err, http.StatusForbidden) {
+		return nil, fmt.Sprintf("the configured user may not list role inference rules, so the token's roles were not checked against the roleset's: %s", err), nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("error listing role inference rules: %w", err)
+	}
+
+	return unlistedRoles(tokenRoles, withImpliedRoles(allowed, rules.RoleInferenceRuleList)), "", nil
+}
+
+// withImpliedRoles returns the roles together with every role they imply,
+// directly or through other implied roles.
+func withImpliedRoles(allowed []applicationcredentials.Role, rules []roles.RoleInferenceRules) []applicationcredentials.Role {
+	expanded := slices.Clone(allowed)
+	for i := 0; i < len(expanded); i++ {
+		ref := expanded[i]
+		for _, rule := range rules {
+			if (ref.ID == "" || ref.ID != rule.PriorRole.ID) && (ref.ID != "" || ref.Name != rule.PriorRole.Name) {
+				continue
+			}
+			for _, implied := range rule.ImpliedRoles {
+				known := slices.ContainsFunc(expanded, func(r applicationcredentials.Role) bool {
+					return (r.ID != "" && r.ID == implied.ID) || (r.ID == "" && r.Name == implied.Name)
+				})
+				if !known {
+					expanded = append(expanded, applicationcredentials.Role{ID: implied.ID, Name: implied.Name})
+				}
+			}
+		}
+	}
+	return expanded
+}
+
+// unlistedRoles returns the names of the token roles that aren't among the
+// roleset's roles. A roleset without roles delegates all of them.
+func unlistedRoles(tokenRoles []tokens.Role, allowed []applicationcredentials.Role) []string {
+	if len(allowed) == 0 {
+		return nil
+	}
+
+	var extra []string
+	for _, tokenRole := range tokenRoles {
+		listed := false
+		for _, ref := range allowed {
+			if (ref.ID != "" && ref.ID == tokenRole.ID) || (ref.ID == "" && ref.Name == tokenRole.Name) {
+				listed = true
+				break
+			}
+		}
+		if !listed {
+			extra = append(extra, tokenRole.Name)
+		}
+	}
+
+	return extra
+}
+
+var pathTokenHelpSyn = "Issue a Keystone token scoped to a roleset's project"
+
+var pathTokenHelpDesc = `
+Authenticates with the roleset's access config and project scope and returns
+the resulting Keystone token together with its expiry and service catalog.
+The token is revoked when the lease is revoked. Tokens carry every role the
+configured user holds on the project and the roles those imply, so they are
+refused when that goes beyond the roleset's roles and the roles they imply.
+`
@@ -0,0 +1,211 @@
+package openstack
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestToken_Validation(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/missing",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for unknown roleset, got %#v", resp)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/scoped",
+		Data: map[string]interface{}{
+			"project_id": "project-a",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/scoped",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error without access config, got %#v", resp)
+	}
+
+	_, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "config/auth",
+		Data: map[string]interface{}{
+			"auth_url":                      "https://keystone.example.com/v3",
+			"application_credential_id":     "app-cred-id",
+			"application_credential_secret": "app-cred-secret",
+			"verify_connection":             false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "token/scoped",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error for project-scoped roleset with application credential auth, got %#v", resp)
+	}
+}
+
+func TestUnlistedRoles(t *testing.T) {
+	t.Parallel()
+
+	tokenRoles := []tokens.Role{
+		{ID: "1", Name: "member"},
+		{ID: "2", Name: "reader"},
+		{ID: "3", Name: "admin"},
+	}
+
+	tests := []struct {
+		name     string
+		allowed  []applicationcredentials.Role
+		expected []string
+	}{
+		{
+			name: "roleset without roles",
+		},
+		{
+			name: "all roles listed",
+			allowed: []applicationcredentials.Role{
+				{ID: "1"},
+				{Name: "reader"},
+				{Name: "admin"},
+			},
+		},
+		{
+			name: "extra roles",
+			allowed: []applicationcredentials.Role{
+				{Name: "member"},
+			},
+			expected: []string{"reader", "admin"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			extra := unlistedRoles(tokenRoles, tc.allowed)
+			if len(extra) != len(tc.expected) {
+				t.Fatalf("unlisted roles = %v, expected %v", extra, tc.expected)
+			}
+			for i := range extra {
+				if extra[i] != tc.expected[i] {
+					t.Errorf("unlisted roles = %v, expected %v", extra, tc.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestWithImpliedRoles(t *testing.T) {
+	t.Parallel()
+
+	rules := []roles.RoleInferenceRules{
+		{
+			PriorRole:    roles.PriorRoleObject{ID: "1", Name: "admin"},
+			ImpliedRoles: []roles.ImpliedRoleObject{{ID: "2", Name: "member"}},
+		},
+		{
+			PriorRole:    roles.PriorRoleObject{ID: "2", Name: "member"},
+			ImpliedRoles: []roles.ImpliedRoleObject{{ID: "3", Name: "reader"}},
+		},
+	}
+
+	expanded := withImpliedRoles([]applicationcredentials.Role{{Name: "admin"}}, rules)
+	expected := []applicationcredentials.Role{
+		{Name: "admin"},
+		{ID: "2", Name: "member"},
+		{ID: "3", Name: "reader"},
+	}
+	if !reflect.DeepEqual(expanded, expected) {
+		t.Errorf("expanded roles = %#v, expected %#v", expanded, expected)
+	}
+
+	expanded = withImpliedRoles([]applicationcredentials.Role{{ID: "3"}}, rules)
+	if !reflect.DeepEqual(expanded, []applicationcredentials.Role{{ID: "3"}}) {
+		t.Errorf("expected reader to imply nothing, got %#v", expanded)
+	}
+}
+
+func TestToken_ImpliedRoles(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	request(logical.UpdateOperation, configAccessKey, map[string]interface{}{
+		"auth_url":          ks.URL + "/v3",
+		"username":          "svc",
+		"user_domain_id":    "default",
+		"password":          "secret",
+		"verify_connection": false,
+	})
+	request(logical.UpdateOperation, "roleset/member", map[string]interface{}{
+		"project_id":        "project123",
+		"roles":             "member",
+		"verify_connection": false,
+	})
+	request(logical.UpdateOperation, "roleset/reader", map[string]interface{}{
+		"project_id":        "project123",
+		"roles":             "reader",
+		"verify_connection": false,
+	})
+
+	// The token also carries reader, which member implies
+	resp := request(logical.ReadOperation, "token/member", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("expected a token, got %#v", resp)
+	}
+
+	// Reader doesn't imply member
+	resp = request(logical.ReadOperation, "token/reader", nil)
+	if resp == nil || !resp.IsError() || !strings.Contains(resp.Error().Error(), "member") {
+		t.Fatalf("expected the member role to be refused, got %#v", resp)
+	}
+}
@@ -0,0 +1,366 @@
+package openstack
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	poolPrefix = "pool/"
+
+	// poolRefillTimeout bounds a background refill of one roleset's pool.
+	poolRefillTimeout = 5 * time.Minute
+)
+
+// pooledCredential is an application credential created ahead of time for
+// a roleset with a pool_size, waiting to be handed out.
+type pooledCredential struct {
+	ID          string    `json:"id"`
+	Secret      string    `json:"secret"`
+	UserID      string    `json:"user_id"`
+	Cloud       string    `json:"cloud,omitempty"`
+	RoleSetHash string    `json:"roleset_hash"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// poolHash identifies the definition of a roleset, so that credentials
+// pooled before the roleset changed are never handed out. Settings that
+// don't affect the credentials themselves are left out.
+func (r *RoleSet) poolHash() (string, error) {
+	definition := *r
+	definition.PoolSize = 0
+	definition.MaxActiveLeases = 0
+	definition.RateLimit = 0
+	definition.RateLimitPeriod = 0
+
+	encoded, err := json.Marshal(definition)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// usable reports whether the pooled credential can be handed out for the
+// roleset with at least minExpiry left in Keystone.
+func (p *pooledCredential) usable(hash string, minExpiry time.Time) bool {
+	return p.RoleSetHash == hash && !p.ExpiresAt.Before(minExpiry)
+}
+
+// claimPooledCredential removes a credential from the pool, returning nil if
+// another caller claimed it first.
+func (b *backend) claimPooledCredential(ctx context.Context, storage logical.Storage, name, id string) (*pooledCredential, error) {
+	b.poolLock.Lock()
+	defer b.poolLock.Unlock()
+
+	return b.claimPooledCredentialLocked(ctx, storage, name, id)
+}
+
+func (b *backend) claimPooledCredentialLocked(ctx context.Context, storage logical.Storage, name, id string) (*pooledCredential, error) {
+	key := poolPrefix + name + "/" + id
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	pooled := &pooledCredential{}
+	if err := entry.DecodeJSON(pooled); err != nil {
+		return nil, err
+	}
+	if err := storage.Delete(ctx, key); err != nil {
+		return nil, err
+	}
+	return pooled, nil
+}
+
+// takePooledCredential claims a credential from the roleset's pool that
+// matches its current definition and is valid until at least minExpiry. The
+// claim is covered by a WAL entry, whose ID is returned, until the caller has
+// handed the credential on and deletes it.
+func (b *backend) takePooledCredential(ctx context.Context, storage logical.Storage, name string, role *RoleSet, minExpiry time.Time) (*pooledCredential, string, error) {
+	hash, err := role.poolHash()
+	if err != nil {
+		return nil, "", err
+	}
+
+	b.poolLock.Lock()
+	defer b.poolLock.Unlock()
+
+	ids, err := storage.List(ctx, poolPrefix+name+"/")
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, id := range ids {
+		entry, err := storage.Get(ctx, poolPrefix+name+"/"+id)
+		if err != nil {
+			return nil, "", err
+		}
+		if entry == nil {
+			continue
+		}
+
+		pooled := &pooledCredential{}
+		if err := entry.DecodeJSON(pooled); err != nil {
+			return nil, "", err
+		}
+		if !pooled.usable(hash, minExpiry) {
+			continue
+		}
+
+		// The rollback leaves credentials alone while they are still
+		// pooled, so the entry can be written ahead of the claim.
+		walID, err := framework.PutWAL(ctx, storage, walTypeApplicationCredential, &walApplicationCredential{
+			RoleSet: name,
+			Cloud:   pooled.Cloud,
+			UserID:  pooled.UserID,
+			ID:      pooled.ID,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("error writing WAL entry: %w", err)
+		}
+
+		pooled, err = b.claimPooledCredentialLocked(ctx, storage, name, id)
+		if err != nil {
+			return nil, "", err
+		}
+		if pooled == nil {
+			return nil, "", framework.DeleteWAL(ctx, storage, walID)
+		}
+		return pooled, walID, nil
+	}
+
+	return nil, "", nil
+}
+
+// refillPoolAsync refills the roleset's pool in the background.
+func (b *backend) refillPoolAsync(storage logical.Storage, name string) {
+	b.poolRefills.Add(1)
+	go func() {
+		defer b.poolRefills.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), poolRefillTimeout)
+		defer cancel()
+
+		if err := b.refillPool(ctx, storage, name); err != nil {
+			b.Logger().Warn("failed to refill credential pool", "roleset", name, "error", err)
+		}
+	}()
+}
+
+// refillPools refills the pools of every roleset and discards those left
+// behind by deleted rolesets.
+func (b *backend) refillPools(ctx context.Context, storage logical.Storage) error {
+	rolesets, err := storage.List(ctx, "roleset/")
+	if err != nil {
+		return err
+	}
+	pools, err := storage.List(ctx, poolPrefix)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(rolesets)+len(pools))
+	for _, name := range rolesets {
+		names[name] = true
+	}
+	for _, name := range pools {
+		names[strings.TrimSuffix(name, "/")] = true
+	}
+
+	var errs error
+	for name := range names {
+		if err := b.refillPool(ctx, storage, name); err != nil {
+			errs = errors.Join(errs, fmt.Errorf("roleset %q: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// refillPool discards pooled credentials that no longer match the roleset
+// or are close to expiry and creates new ones up to the roleset's pool_size.
+func (b *backend) refillPool(ctx context.Context, storage logical.Storage, name string) error {
+	if !b.startPoolRefill(name) {
+		return nil
+	}
+	defer b.finishPoolRefill(name)
+
+	role, err := b.Role(ctx, storage, name)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		role = &RoleSet{}
+	}
+	hash, err := role.poolHash()
+	if err != nil {
+		return err
+	}
+
+	ids, err := storage.List(ctx, poolPrefix+name+"/")
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 && role.PoolSize == 0 {
+		return nil
+	}
+
+	var cfg *Config
+	if role.PoolSize > 0 {
+		if cfg, err = b.configForRole(ctx, storage, role); err != nil {
+			return fmt.Errorf("error reading access config: %w", err)
+		}
+		if cfg == nil {
+			return errors.New("access config not found")
+		}
+	}
+
+	leaseConfig, err := b.LeaseConfig(ctx, storage)
+	if err != nil {
+		return err
+	}
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
+	}
+	ttl, maxTTL := b.leaseTTLs(role, leaseConfig)
+	minExpiry := time.Now().Add(maxTTL / 2)
+
+	available := 0
+	var errs error
+	for _, id := range ids {
+		entry, err := storage.Get(ctx, poolPrefix+name+"/"+id)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+
+		pooled := &pooledCredential{}
+		if err := entry.DecodeJSON(pooled); err != nil {
+			return err
+		}
+		if available < role.PoolSize && pooled.usable(hash, minExpiry) {
+			available++
+			continue
+		}
+
+		if err := b.discardPooledCredential(ctx, storage, name, id); err != nil {
+			errs = errors.Join(errs, err)
+		}
+	}
+
+	if available >= role.PoolSize {
+		return errs
+	}
+
+	identityClient, err := b.cachedClient(ctx, cfg, role)
+	if err != nil {
+		return errors.Join(errs, fmt.Errorf("error creating identity client: %w", err))
+	}
+
+	is := &issuance{
+		name:           name,
+		role:           role,
+		cfg:            cfg,
+		identityClient: identityClient,
+		ttl:            ttl,
+		maxTTL:         maxTTL,
+	}
+	for ; available < role.PoolSize; available++ {
+		// The slot number keeps names unique within the millisecond, which
+		// rollbacks find credentials by.
+		name := fmt.Sprintf("vault-%s-pool%d-%d", is.name, available, time.Now().UnixMilli())
+		if err := b.addPooledCredential(ctx, storage, is, name, hash); err != nil {
+			return errors.Join(errs, err)
+		}
+	}
+
+	return errs
+}
+
+func (b *backend) addPooledCredential(ctx context.Context, storage logical.Storage, is *issuance, name, hash string) error {
+	credential, userID, walID, err := b.createApplicationCredential(ctx, storage, is, name)
+	if err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(poolPrefix+is.name+"/"+credential.ID, &pooledCredential{
+		ID:          credential.ID,
+		Secret:      credential.Secret,
+		UserID:      userID,
+		Cloud:       is.role.Cloud,
+		RoleSetHash: hash,
+		ExpiresAt:   credential.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	if err := storage.Put(ctx, entry); err != nil {
+		return fmt.Errorf("error storing pooled credential: %w", err)
+	}
+
+	if err := framework.DeleteWAL(ctx, storage, walID); err != nil {
+		return fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+	return nil
+}
+
+// discardPooledCredential removes a credential from the pool and deletes it
+// in Keystone.
+func (b *backend) discardPooledCredential(ctx context.Context, storage logical.Storage, name, id string) error {
+	pooled, err := b.claimPooledCredential(ctx, storage, name, id)
+	if err != nil {
+		return err
+	}
+	if pooled == nil {
+		return nil
+	}
+
+	identityClient, err := b.rollbackClient(ctx, storage, name, &pooled.Cloud)
+	if err != nil {
+		return err
+	}
+	if identityClient != nil {
+		if err := applicationcredentials.Delete(ctx, identityClient, pooled.UserID, pooled.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			return fmt.Errorf("error deleting pooled credential %q: %w", pooled.ID, err)
+		}
+	}
+
+	return storage.Delete(ctx, issuedCredentialPrefix+pooled.ID)
+}
+
+// startPoolRefill marks the roleset's pool as being refilled, returning
+// false if a refill is already under way.
+func (b *backend) startPoolRefill(name string) bool {
+	b.poolLock.Lock()
+	defer b.poolLock.Unlock()
+
+	if b.poolRefilling[name] {
+		return false
+	}
+	b.poolRefilling[name] = true
+	return true
+}
+
+func (b *backend) finishPoolRefill(name string) {
+	b.poolLock.Lock()
+	defer b.poolLock.Unlock()
+
+	delete(b.poolRefilling, name)
+}
@@ -0,0 +1,226 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	backend := b.(*backend)
+	ks := newTestKeystone(t)
+
+	write := func(path string, data map[string]interface{}) {
+		t.Helper()
+		data["verify_connection"] = false
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatal(resp.Error())
+		}
+		backend.poolRefills.Wait()
+	}
+
+	poolSize := func() int {
+		t.Helper()
+		ids, err := reqStorage.List(context.Background(), poolPrefix+"member/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(ids)
+	}
+
+	write(configAccessKey, map[string]interface{}{
+		"auth_url":       ks.URL + "/v3",
+		"username":       "svc",
+		"user_domain_id": "default",
+		"password":       "secret",
+	})
+	write("roleset/member", map[string]interface{}{
+		"project_id": "project123",
+		"roles":      "member",
+		"pool_size":  2,
+	})
+	if n := poolSize(); n != 2 {
+		t.Fatalf("expected 2 pooled credentials, got %d", n)
+	}
+
+	// Credentials are handed out from the pool, which is then refilled
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/member",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected credentials, got %#v", resp)
+	}
+	id := resp.Data["application_credential_id"]
+	if id != "appcred-1" && id != "appcred-2" {
+		t.Errorf("expected a pooled credential, got %v", id)
+	}
+	if resp.Secret.MaxTTL > maxLeaseTTLHr*time.Hour {
+		t.Errorf("MaxTTL = %s, expected at most %dh", resp.Secret.MaxTTL, maxLeaseTTLHr)
+	}
+	backend.poolRefills.Wait()
+	if n := poolSize(); n != 2 {
+		t.Errorf("expected the pool to be refilled to 2, got %d", n)
+	}
+	if n := ks.appCredCreates.Load(); n != 3 {
+		t.Errorf("expected 3 application credentials to be created, got %d", n)
+	}
+
+	// Changing the roleset replaces the pooled credentials
+	write("roleset/member", map[string]interface{}{"roles": "member,reader"})
+	if n := ks.appCredDeletes.Load(); n != 2 {
+		t.Errorf("expected 2 pooled credentials to be discarded, got %d", n)
+	}
+	if n := poolSize(); n != 2 {
+		t.Errorf("expected 2 pooled credentials, got %d", n)
+	}
+
+	// Deleting the roleset empties its pool
+	resp, err = b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.DeleteOperation,
+		Path:      "roleset/member",
+		Storage:   reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.poolRefills.Wait()
+	if n := poolSize(); n != 0 {
+		t.Errorf("expected an empty pool, got %d", n)
+	}
+	if n := ks.appCredDeletes.Load(); n != 4 {
+		t.Errorf("expected 4 pooled credentials to be discarded, got %d", n)
+	}
+}
+
+func TestPool_ClaimRollback(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	backend := b.(*backend)
+	ks := newTestKeystone(t)
+
+	// The config is written first so that the pool can be filled.
+	for _, write := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{configAccessKey, map[string]interface{}{
+			"auth_url":       ks.URL + "/v3",
+			"username":       "svc",
+			"user_domain_id": "default",
+			"password":       "secret",
+		}},
+		{"roleset/member", map[string]interface{}{
+			"project_id": "project123",
+			"roles":      "member",
+			"pool_size":  2,
+		}},
+	} {
+		write.data["verify_connection"] = false
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      write.path,
+			Data:      write.data,
+			Storage:   reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+		backend.poolRefills.Wait()
+	}
+
+	role, err := backend.Role(context.Background(), reqStorage, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The claim is covered until the lease makes it back to Vault
+	pooled, walID, err := backend.takePooledCredential(context.Background(), reqStorage, "member", role, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pooled == nil {
+		t.Fatal("expected a pooled credential")
+	}
+	entry, err := framework.GetWAL(context.Background(), reqStorage, walID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry == nil {
+		t.Fatal("expected a WAL entry for the claimed credential")
+	}
+
+	// Credentials that are still pooled are left alone
+	ids, err := reqStorage.List(context.Background(), poolPrefix+"member/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 {
+		t.Fatalf("expected 1 pooled credential left, got %d", len(ids))
+	}
+	stillPooled := map[string]interface{}{
+		"roleset": "member",
+		"cloud":   "",
+		"user_id": "user123",
+		"id":      ids[0],
+	}
+	if err := backend.walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeApplicationCredential, stillPooled); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.appCreds.Load(ids[0]); !ok {
+		t.Error("expected the pooled credential to be left alone")
+	}
+
+	if err := backend.walRollback(context.Background(), &logical.Request{Storage: reqStorage}, entry.Kind, entry.Data); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ks.appCreds.Load(pooled.ID); ok {
+		t.Error("expected the claimed credential to be rolled back")
+	}
+}
+
+func TestRoleSet_PoolSizeValidation(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	for _, data := range []map[string]interface{}{
+		{"pool_size": -1},
+		{"pool_size": 1, "credential_type": credentialTypeEC2},
+		{"pool_size": 1, "scope_type": scopeTypeSystem},
+	} {
+		data["verify_connection"] = false
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.CreateOperation,
+			Path:      "roleset/test",
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp == nil || !resp.IsError() {
+			t.Errorf("expected error response for %v, got %#v", data, resp)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package openstack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/ec2credentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/trusts"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	walTypeApplicationCredential = "application_credential"
+	walTypeDynamicUser           = "dynamic_user"
+	walTypeEC2Credential         = "ec2_credential"
+	walTypeTrust                 = "trust"
+	walTypeRoleGrant             = "role_grant"
+	walTypeEphemeralProject      = "ephemeral_project"
+
+	// walRollbackMinAge must be longer than it takes pathTokenRead to create
+	// an application credential and return its lease.
+	walRollbackMinAge = 5 * time.Minute
+)
+
+// walApplicationCredential is written before an application credential is
+// created, or claimed from a pool, and deleted once its lease has been handed
+// to Vault. Entries that are left behind identify credentials that may have
+// been orphaned: created ones by name, pooled ones by ID.
+type walApplicationCredential struct {
+	RoleSet string `json:"roleset" mapstructure:"roleset"`
+	Cloud   string `json:"cloud" mapstructure:"cloud"`
+	UserID  string `json:"user_id" mapstructure:"user_id"`
+	Name    string `json:"name" mapstructure:"name"`
+	ID      string `json:"id,omitempty" mapstructure:"id"`
+}
+
+// walDynamicUser is written before a dynamic user is created and deleted
+// once its lease has been handed to Vault.
+type walDynamicUser struct {
+	RoleSet  string `json:"roleset" mapstructure:"roleset"`
+	Cloud    string `json:"cloud" mapstructure:"cloud"`
+	DomainID string `json:"domain_id" mapstructure:"domain_id"`
+	UserID   string `json:"user_id" mapstructure:"user_id"`
+	Name     string `json:"name" mapstructure:"name"`
+}
+
+// walEC2Credential is written before an EC2 credential is created and
+// deleted once its lease has been handed to Vault.
+type walEC2Credential struct {
+	RoleSet string `json:"roleset" mapstructure:"roleset"`
+	Cloud   string `json:"cloud" mapstructure:"cloud"`
+	UserID  string `json:"user_id" mapstructure:"user_id"`
+	Access  string `json:"access" mapstructure:"access"`
+}
+
+// walTrust is written before a trust is created and deleted once its lease
+// has been handed to Vault. Trusts are identified by their trustor, trustee,
+// project and expiry.
+type walTrust struct {
+	RoleSet       string `json:"roleset" mapstructure:"roleset"`
+	Cloud         string `json:"cloud" mapstructure:"cloud"`
+	TrustorUserID string `json:"trustor_user_id" mapstructure:"trustor_user_id"`
+	TrusteeUserID string `json:"trustee_user_id" mapstructure:"trustee_user_id"`
+	ProjectID     string `json:"project_id" mapstructure:"project_id"`
+	ExpiresAt     string `json:"expires_at" mapstructure:"expires_at"`
+}
+
+// walRoleGrant is written before roles are assigned for a grant and deleted
+// once its lease has been handed to Vault. The rollback releases whichever of
+// the roles the grant came to hold.
+type walRoleGrant struct {
+	RoleSet   string   `json:"roleset" mapstructure:"roleset"`
+	Cloud     string   `json:"cloud" mapstructure:"cloud"`
+	UserID    string   `json:"user_id" mapstructure:"user_id"`
+	GroupID   string   `json:"group_id" mapstructure:"group_id"`
+	ProjectID string   `json:"project_id" mapstructure:"project_id"`
+	GrantID   string   `json:"grant_id" mapstructure:"grant_id"`
+	RoleIDs   []string `json:"role_ids" mapstructure:"role_ids"`
+}
+
+// walEphemeralProject is written before an ephemeral project is created and
+// deleted once its lease has been handed to Vault.
+type walEphemeralProject struct {
+	RoleSet  string `json:"roleset" mapstructure:"roleset"`
+	Cloud    string `json:"cloud" mapstructure:"cloud"`
+	DomainID string `json:"domain_id" mapstructure:"domain_id"`
+	UserID   string `json:"user_id" mapstructure:"user_id"`
+	Name     string `json:"name" mapstructure:"name"`
+}
+
+func (b *backend) walRollback(ctx context.Context, req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case walTypeApplicationCredential:
+		return b.applicationCredentialRollback(ctx, req, data)
+	case walTypeDynamicUser:
+		return b.dynamicUserRollback(ctx, req, data)
+	case walTypeEC2Credential:
+		return b.ec2CredentialRollback(ctx, req, data)
+	case walTypeTrust:
+		return b.trustRollback(ctx, req, data)
+	case walTypeRoleGrant:
+		return b.roleGrantRollback(ctx, req, data)
+	case walTypeEphemeralProject:
+		return b.ephemeralProjectRollback(ctx, req, data)
+	default:
+		return fmt.Errorf("unknown rollback type %q", kind)
+	}
+}
+
+func (b *backend) applicationCredentialRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walApplicationCredential
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping application credential rollback without access config", "name", entry.Name)
+		return nil
+	}
+
+	if entry.ID != "" {
+		return b.pooledCredentialRollback(ctx, req.Storage, identityClient, entry)
+	}
+
+	pages, err := applicationcredentials.List(identityClient, entry.UserID, applicationcredentials.ListOpts{
+		Name: entry.Name,
+	}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing application credentials: %w", err)
+	}
+	credentials, err := applicationcredentials.ExtractApplicationCredentials(pages)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, credential := range credentials {
+		if err := applicationcredentials.Delete(ctx, identityClient, entry.UserID, credential.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if err := req.Storage.Delete(ctx, issuedCredentialPrefix+credential.ID); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		b.Logger().Info("rolled back orphaned application credential", "id", credential.ID, "name", entry.Name)
+	}
+
+	return errs
+}
+
+// pooledCredentialRollback deletes a credential claimed from a pool, unless
+// the claim never happened and it is still pooled.
+func (b *backend) pooledCredentialRollback(ctx context.Context, storage logical.Storage, identityClient *gophercloud.ServiceClient, entry walApplicationCredential) error {
+	pooled, err := storage.Get(ctx, poolPrefix+entry.RoleSet+"/"+entry.ID)
+	if err != nil {
+		return err
+	}
+	if pooled != nil {
+		return nil
+	}
+
+	if err := applicationcredentials.Delete(ctx, identityClient, entry.UserID, entry.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return err
+	}
+	b.Logger().Info("rolled back orphaned pooled application credential", "id", entry.ID)
+
+	return storage.Delete(ctx, issuedCredentialPrefix+entry.ID)
+}
+
+func (b *backend) dynamicUserRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walDynamicUser
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping dynamic user rollback without access config", "name", entry.Name)
+		return nil
+	}
+
+	pages, err := users.List(identityClient, users.ListOpts{
+		Name:     entry.Name,
+		DomainID: entry.DomainID,
+	}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing users: %w", err)
+	}
+	found, err := users.ExtractUsers(pages)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, user := range found {
+		if err := users.Delete(ctx, identityClient, user.ID).ExtractErr(); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		b.Logger().Info("rolled back orphaned dynamic user", "id", user.ID, "name", entry.Name)
+	}
+
+	return errs
+}
+
+func (b *backend) ec2CredentialRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walEC2Credential
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping EC2 credential rollback without access config", "access", entry.Access)
+		return nil
+	}
+
+	if err := ec2credentials.Delete(ctx, identityClient, entry.UserID, entry.Access).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return err
+	}
+	b.Logger().Info("rolled back orphaned EC2 credential", "access", entry.Access)
+
+	return nil
+}
+
+func (b *backend) trustRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walTrust
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping trust rollback without access config", "trustee_user_id", entry.TrusteeUserID)
+		return nil
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339Nano, entry.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("invalid trust expiry %q: %w", entry.ExpiresAt, err)
+	}
+
+	pages, err := trusts.List(identityClient, trusts.ListOpts{
+		TrustorUserID: entry.TrustorUserID,
+		TrusteeUserID: entry.TrusteeUserID,
+	}).AllPages(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing trusts: %w", err)
+	}
+	found, err := trusts.ExtractTrusts(pages)
+	if err != nil {
+		return err
+	}
+
+	var errs error
+	for _, trust := range found {
+		if trust.ProjectID != entry.ProjectID || !trust.ExpiresAt.Equal(expiresAt) {
+			continue
+		}
+		if err := trusts.Delete(ctx, identityClient, trust.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		b.Logger().Info("rolled back orphaned trust", "id", trust.ID)
+	}
+
+	return errs
+}
+
+func (b *backend) roleGrantRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walRoleGrant
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+	if len(entry.RoleIDs) == 0 {
+		return nil
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping role grant rollback without access config", "project_id", entry.ProjectID)
+		return nil
+	}
+
+	assignment := roleAssignment{
+		cloud:     entry.Cloud,
+		userID:    entry.UserID,
+		groupID:   entry.GroupID,
+		projectID: entry.ProjectID,
+	}
+	if err := b.releaseRoleAssignments(ctx, req.Storage, identityClient, assignment, entry.GrantID, entry.RoleIDs); err != nil {
+		return err
+	}
+	b.Logger().Info("rolled back orphaned role grant", "user_id", entry.UserID, "group_id", entry.GroupID, "project_id", entry.ProjectID)
+
+	return nil
+}
+
+func (b *backend) ephemeralProjectRollback(ctx context.Context, req *logical.Request, data interface{}) error {
+	var entry walEphemeralProject
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	identityClient, err := b.rollbackClient(ctx, req.Storage, entry.RoleSet, walCloud(data))
+	if err != nil {
+		return err
+	}
+	if identityClient == nil {
+		b.Logger().Warn("dropping ephemeral project rollback without access config", "name", entry.Name)
+		return nil
+	}
+
+	// The application credential shares the project's name. Entries written
+	// before the user was recorded leave it to the project deletion.
+	var errs error
+	if entry.UserID != "" {
+		pages, err := applicationcredentials.List(identityClient, entry.UserID, applicationcredentials.ListOpts{
+			Name: entry.Name,
+		}).AllPages(ctx)
+		if err != nil {
+			return fmt.Errorf("error listing application credentials: %w", err)
+		}
+		credentials, err := applicationcredentials.ExtractApplicationCredentials(pages)
+		if err != nil {
+			return err
+		}
+		for _, credential := range credentials {
+			if err := applicationcredentials.Delete(ctx, identityClient, entry.UserID, credential.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if err := req.Storage.Delete(ctx, issuedCredentialPrefix+credential.ID); err != nil {
+				errs = errors.Join(errs, err)
+			}
+		}
+	}
+
+	pages, err := projects.List(identityClient, projects.ListOpts{
+		Name:     entry.Name,
+		DomainID: entry.DomainID,
+	}).AllPages(ctx)
+	if err != nil {
+		return errors.Join(errs, fmt.Errorf("error listing projects: %w", err))
+	}
+	found, err := projects.ExtractProjects(pages)
+	if err != nil {
+		return errors.Join(errs, err)
+	}
+
+	for _, project := range found {
+		if err := projects.Delete(ctx, identityClient, project.ID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		b.Logger().Info("rolled back orphaned ephemeral project", "id", project.ID, "name", entry.Name)
+	}
+
+	return errs
+}
+
+// rollbackClient returns an identity client for the cloud recorded in a WAL
+// entry, with the roleset's scope if the roleset still lives there. Entries
+// without a recorded cloud fall back to the roleset's cloud, or to
+// config/auth once the roleset is gone. It returns nil if there is no
+// configuration to reach Keystone with anymore.
+func (b *backend) rollbackClient(ctx context.Context, storage logical.Storage, rolesetName string, cloud *string) (*gophercloud.ServiceClient, error) {
+	if cloud == nil {
+		role, err := b.Role(ctx, storage, rolesetName)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			cloud = new(string)
+		}
+	}
+
+	identityClient, _, err := b.issuedClient(ctx, storage, rolesetName, cloud)
+	return identityClient, err
+}
+
+// walCloud returns the cloud recorded in the data of a WAL entry, or nil if
+// none was recorded.
+func walCloud(data interface{}) *string {
+	entry, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	cloud, ok := entry["cloud"].(string)
+	if !ok {
+		return nil
+	}
+	return &cloud
+}
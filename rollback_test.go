@@ -0,0 +1,344 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestWALRollback_UnknownKind(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, "unknown", nil)
+	if err == nil {
+		t.Fatal("expected error for unknown WAL kind")
+	}
+}
+
+func TestWALRollback_ApplicationCredentialWithoutConfig(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	// Entries are decoded from the JSON stored in the WAL
+	data := map[string]interface{}{
+		"roleset": "deleted",
+		"cloud":   "",
+		"user_id": "user123",
+		"name":    "vault-deleted-token-1674140730969",
+	}
+
+	err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeApplicationCredential, data)
+	if err != nil {
+		t.Fatalf("expected entry to be dropped without access config, got: %v", err)
+	}
+}
+
+func TestWALRollback_ApplicationCredential(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	issuing := newTestKeystone(t)
+	other := newTestKeystone(t)
+
+	for path, ks := range map[string]*testKeystone{
+		configAccessKey:             issuing,
+		configCloudPrefix + "other": other,
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data: map[string]interface{}{
+				"auth_url":          ks.URL + "/v3",
+				"username":          "svc",
+				"user_domain_id":    "default",
+				"password":          "secret",
+				"verify_connection": false,
+			},
+			Storage: reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// The roleset has moved since the credential was created
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roleset/member",
+		Data: map[string]interface{}{
+			"cloud":             "other",
+			"project_id":        "project123",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// The credential was tracked before its lease was lost
+	issuing.appCreds.Store("orphan", testAppCred{Name: "vault-member-token-1674140730969"})
+	if err := b.(*backend).putIssuedCredential(context.Background(), reqStorage, "orphan", &issuedCredential{
+		RoleSet:   "member",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"roleset": "member",
+		"cloud":   "",
+		"user_id": "user123",
+		"name":    "vault-member-token-1674140730969",
+	}
+
+	if err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeApplicationCredential, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := issuing.appCredDeletes.Load(); n != 1 {
+		t.Errorf("expected the orphaned credential to be deleted from the issuing cloud, got %d deletes", n)
+	}
+	if _, ok := issuing.appCreds.Load("orphan"); ok {
+		t.Error("expected the orphaned credential to be gone")
+	}
+	if n := other.appCredDeletes.Load(); n != 0 {
+		t.Errorf("expected no deletes in the roleset's current cloud, got %d", n)
+	}
+	if entry, err := reqStorage.Get(context.Background(), issuedCredentialPrefix+"orphan"); err != nil || entry != nil {
+		t.Errorf("expected the tracking record to be deleted with the credential, got %v, %v", entry, err)
+	}
+}
+
+func TestWALRollback_EphemeralProject(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      configAccessKey,
+		Data: map[string]interface{}{
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		Storage: reqStorage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err: %v resp: %#v", err, resp)
+	}
+
+	// The lease was lost after the project's credential was tracked
+	ks.appCreds.Store("orphan", testAppCred{Name: "vault-sandbox-token-1674140730969"})
+	if err := b.(*backend).putIssuedCredential(context.Background(), reqStorage, "orphan", &issuedCredential{
+		RoleSet:   "sandbox",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]interface{}{
+		"roleset":   "sandbox",
+		"cloud":     "",
+		"domain_id": "default",
+		"user_id":   "user123",
+		"name":      "vault-sandbox-token-1674140730969",
+	}
+
+	if err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeEphemeralProject, data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ks.appCreds.Load("orphan"); ok {
+		t.Error("expected the orphaned credential to be deleted")
+	}
+	if entry, err := reqStorage.Get(context.Background(), issuedCredentialPrefix+"orphan"); err != nil || entry != nil {
+		t.Errorf("expected the tracking record to be deleted with the credential, got %v, %v", entry, err)
+	}
+}
+
+func TestWALRollback_EC2CredentialWithoutConfig(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	data := map[string]interface{}{
+		"roleset": "deleted",
+		"cloud":   "",
+		"user_id": "user123",
+		"access":  "access123",
+	}
+
+	err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeEC2Credential, data)
+	if err != nil {
+		t.Fatalf("expected entry to be dropped without access config, got: %v", err)
+	}
+}
+
+func TestWALRollback_EC2CredentialResponseLost(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	for path, data := range map[string]map[string]interface{}{
+		configAccessKey: {
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		"roleset/ec2": {
+			"project_id":        "project123",
+			"roles":             "member",
+			"credential_type":   credentialTypeEC2,
+			"verify_connection": false,
+		},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// Keystone creates the credential but Vault never hears back
+	ks.loseEC2Responses.Store(true)
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/ec2",
+		Storage:   reqStorage,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected the issuance to fail, got %#v", resp)
+	}
+
+	walIDs, err := framework.ListWAL(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walIDs) != 1 {
+		t.Fatalf("expected 1 WAL entry, got %d", len(walIDs))
+	}
+	entry, err := framework.GetWAL(context.Background(), reqStorage, walIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, entry.Kind, entry.Data); err != nil {
+		t.Fatal(err)
+	}
+
+	ks.ec2Creds.Range(func(access, _ any) bool {
+		t.Errorf("expected EC2 credential %q to be rolled back", access)
+		return true
+	})
+}
+
+func TestWALRollback_TrustResponseLost(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	for path, data := range map[string]map[string]interface{}{
+		configAccessKey: {
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		},
+		"roleset/orchestration": {
+			"project_id":               "project123",
+			"roles":                    "member",
+			"credential_type":          credentialTypeTrust,
+			"allowed_trustee_user_ids": "user456",
+			"verify_connection":        false,
+		},
+	} {
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err: %v resp: %#v", err, resp)
+		}
+	}
+
+	// A trust for another lease of the same trustee must be left alone
+	ks.trusts.Store("live", testTrust{
+		TrustorUserID: "user123",
+		TrusteeUserID: "user456",
+		ProjectID:     "project123",
+		ExpiresAt:     time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano),
+	})
+
+	// Keystone creates the trust but Vault never hears back
+	ks.loseTrustResponses.Store(true)
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/orchestration",
+		Data:      map[string]interface{}{"trustee_user_id": "user456"},
+		Storage:   reqStorage,
+	})
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected the issuance to fail, got %#v", resp)
+	}
+
+	walIDs, err := framework.ListWAL(context.Background(), reqStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walIDs) != 1 {
+		t.Fatalf("expected 1 WAL entry, got %d", len(walIDs))
+	}
+	entry, err := framework.GetWAL(context.Background(), reqStorage, walIDs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, entry.Kind, entry.Data); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := ks.trusts.Load("trust-1"); ok {
+		t.Error("expected the orphaned trust to be rolled back")
+	}
+	if _, ok := ks.trusts.Load("live"); !ok {
+		t.Error("expected the other trust to be left alone")
+	}
+}
+
+func TestWALRollback_TrustWithoutConfig(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	data := map[string]interface{}{
+		"roleset":         "deleted",
+		"cloud":           "",
+		"trustor_user_id": "user123",
+		"trustee_user_id": "user456",
+		"project_id":      "project123",
+		"expires_at":      "2023-01-19T15:05:30.969Z",
+	}
+
+	err := b.(*backend).walRollback(context.Background(), &logical.Request{Storage: reqStorage}, walTypeTrust, data)
+	if err != nil {
+		t.Fatalf("expected entry to be dropped without access config, got: %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/users"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretDynamicUserType = "dynamic_user"
+
+	dynamicUserPasswordLength = 32
+)
+
+func secretDynamicUser(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretDynamicUserType,
+		Fields: map[string]*framework.FieldSchema{
+			"username": {
+				Type:        framework.TypeString,
+				Description: "Name of the dynamic Keystone user",
+			},
+			"password": {
+				Type:        framework.TypeString,
+				Description: "Password of the dynamic Keystone user",
+			},
+		},
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretDynamicUserRevoke),
+	}
+}
+
+func (b *backend) issueDynamicUser(ctx context.Context, req *logical.Request, is *issuance) (*logical.Response, error) {
+	projectID, err := scopedProjectID(is.identityClient)
+	if err != nil {
+		return logical.ErrorResponse("dynamic users require a project-scoped roleset: %s", err), nil
+	}
+
+	roleIDs, err := resolveRoleIDs(ctx, is.identityClient, is.role.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	username := fmt.Sprintf("vault-%s-%s-%d", is.name, req.DisplayName, time.Now().UnixMilli())
+	password, err := base62.Random(dynamicUserPasswordLength)
+	if err != nil {
+		return nil, fmt.Errorf("error generating password: %w", err)
+	}
+
+	// Keystone users never expire on their own; the expiry only bounds how
+	// long the lease can be renewed for.
+	expireTime := time.Now().Add(is.maxTTL)
+
+	walID, err := framework.PutWAL(ctx, req.Storage, walTypeDynamicUser, &walDynamicUser{
+		RoleSet:  is.name,
+		Cloud:    is.role.Cloud,
+		DomainID: is.role.UserDomainID,
+		Name:     username,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	enabled := true
+	user, err := users.Create(ctx, is.identityClient, users.CreateOpts{
+		Name:             username,
+		DomainID:         is.role.UserDomainID,
+		DefaultProjectID: projectID,
+		Description:      fmt.Sprintf("Created by Vault at %s", time.Now().Format(time.RFC3339)),
+		Enabled:          &enabled,
+		Password:         password,
+	}).Extract()
+	if err != nil {
+		b.Logger().Warn("Create user", "error", err)
+		return nil, err
+	}
+
+	for _, roleID := range roleIDs {
+		if err := roles.Assign(ctx, is.identityClient, roleID, roles.AssignOpts{
+			UserID:    user.ID,
+			ProjectID: projectID,
+		}).ExtractErr(); err != nil {
+			// Leave the WAL entry behind if the user can't be removed right
+			// away so that the rollback retries.
+			if delErr := users.Delete(ctx, is.identityClient, user.ID).ExtractErr(); delErr == nil {
+				if walErr := framework.DeleteWAL(ctx, req.Storage, walID); walErr != nil {
+					b.Logger().Warn("failed to delete WAL entry", "error", walErr)
+				}
+			}
+			return nil, fmt.Errorf("error assigning role %q: %w", roleID, err)
+		}
+	}
+
+	resp := b.Secret(SecretDynamicUserType).Response(map[string]interface{}{
+		"username":       user.Name,
+		"password":       password,
+		"user_id":        user.ID,
+		"user_domain_id": user.DomainID,
+		"project_id":     projectID,
+	}, map[string]interface{}{
+		"user_id":    user.ID,
+		"roleset":    is.name,
+		"cloud":      is.role.Cloud,
+		"expires_at": expireTime.Format(time.RFC3339),
+	})
+	resp.Secret.TTL = is.ttl
+	resp.Secret.MaxTTL = is.maxTTL
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (b *backend) secretDynamicUserRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := leaseInternalString(req, "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := users.Delete(ctx, identityClient, userID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,165 @@
+package openstack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/credentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/ec2credentials"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/base62"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretEC2CredentialType = "ec2_credential"
+
+	ec2KeyLength = 32
+)
+
+func secretEC2Credential(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretEC2CredentialType,
+		Fields: map[string]*framework.FieldSchema{
+			"access": {
+				Type:        framework.TypeString,
+				Description: "EC2 access key",
+			},
+			"secret": {
+				Type:        framework.TypeString,
+				Description: "EC2 secret key",
+			},
+		},
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretEC2CredentialRevoke),
+	}
+}
+
+func (b *backend) issueEC2Credential(ctx context.Context, req *logical.Request, is *issuance) (*logical.Response, error) {
+	// EC2 credentials carry neither roles nor access rules of their own.
+	if len(is.role.AccessRules) > 0 {
+		return logical.ErrorResponse("EC2 credentials cannot be issued for rolesets with access_rules"), nil
+	}
+
+	projectID, err := scopedProjectID(is.identityClient)
+	if err != nil {
+		return logical.ErrorResponse("EC2 credentials require a project-scoped roleset: %s", err), nil
+	}
+
+	result, err := authResult(is.identityClient)
+	if err != nil {
+		return nil, err
+	}
+	tokenRoles, err := result.ExtractRoles()
+	if err != nil {
+		return nil, fmt.Errorf("extract roles from token: %w", err)
+	}
+	extra, warning, err := undelegatedRoles(ctx, is.identityClient, tokenRoles, is.role.Roles)
+	if err != nil {
+		return nil, err
+	}
+	if len(extra) > 0 {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"the configured user holds roles on the project that the roleset does not grant: %v", extra,
+		)), nil
+	}
+
+	userID, err := b.userID(is.cfg, is.identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keystone EC2 credentials never expire on their own; the expiry only
+	// bounds how long the lease can be renewed for.
+	expireTime := time.Now().Add(is.maxTTL)
+
+	// The keys are generated here rather than by Keystone so that the WAL
+	// entry can name the credential before it is created.
+	access, err := base62.Random(ec2KeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("error generating access key: %w", err)
+	}
+	secret, err := base62.Random(ec2KeyLength)
+	if err != nil {
+		return nil, fmt.Errorf("error generating secret key: %w", err)
+	}
+	blob, err := json.Marshal(map[string]string{
+		"access": access,
+		"secret": secret,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	walID, err := framework.PutWAL(ctx, req.Storage, walTypeEC2Credential, &walEC2Credential{
+		RoleSet: is.name,
+		Cloud:   is.role.Cloud,
+		UserID:  userID,
+		Access:  access,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	// Keystone stores EC2 credentials created through the credentials API
+	// under the hash of their access key, so they are managed through the
+	// OS-EC2 API like any other.
+	if _, err := credentials.Create(ctx, is.identityClient, credentials.CreateOpts{
+		Blob:      string(blob),
+		ProjectID: projectID,
+		Type:      "ec2",
+		UserID:    userID,
+	}).Extract(); err != nil {
+		b.Logger().Warn("Create ec2credential", "error", err)
+		return nil, err
+	}
+
+	resp := b.Secret(SecretEC2CredentialType).Response(map[string]interface{}{
+		"access":     access,
+		"secret":     secret,
+		"project_id": projectID,
+	}, map[string]interface{}{
+		"access":     access,
+		"user_id":    userID,
+		"roleset":    is.name,
+		"cloud":      is.role.Cloud,
+		"expires_at": expireTime.Format(time.RFC3339),
+	})
+	resp.Secret.TTL = is.ttl
+	resp.Secret.MaxTTL = is.maxTTL
+	if warning != "" {
+		resp.AddWarning(warning)
+	}
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (b *backend) secretEC2CredentialRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := leaseInternalString(req, "user_id")
+	if err != nil {
+		return nil, err
+	}
+	access, err := leaseInternalString(req, "access")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ec2credentials.Delete(ctx, identityClient, userID, access).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
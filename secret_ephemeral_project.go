@@ -0,0 +1,264 @@
+package openstack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack"
+	volumequotas "github.com/gophercloud/gophercloud/v2/openstack/blockstorage/v3/quotasets"
+	computequotas "github.com/gophercloud/gophercloud/v2/openstack/compute/v2/quotasets"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/projects"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/roles"
+	networkquotas "github.com/gophercloud/gophercloud/v2/openstack/networking/v2/extensions/quotas"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretEphemeralProjectType = "ephemeral_project"
+)
+
+// projectQuotas holds the quotas set on ephemeral projects. Services without
+// an entry keep their default quotas.
+type projectQuotas struct {
+	Compute *computequotas.UpdateOpts `json:"compute,omitempty"`
+	Network *networkquotas.UpdateOpts `json:"network,omitempty"`
+	Volume  *volumequotas.UpdateOpts  `json:"volume,omitempty"`
+}
+
+func parseProjectQuotas(raw string) (*projectQuotas, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	decoder.DisallowUnknownFields()
+
+	quotas := &projectQuotas{}
+	if err := decoder.Decode(quotas); err != nil {
+		return nil, err
+	}
+	return quotas, nil
+}
+
+func secretEphemeralProject(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretEphemeralProjectType,
+		Fields: map[string]*framework.FieldSchema{
+			"project_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the ephemeral project",
+			},
+			"application_credential_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the application credential scoped to the project",
+			},
+			"application_credential_secret": {
+				Type:        framework.TypeString,
+				Description: "Secret of the application credential scoped to the project",
+			},
+		},
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretEphemeralProjectRevoke),
+	}
+}
+
+func (b *backend) issueEphemeralProject(ctx context.Context, req *logical.Request, is *issuance) (*logical.Response, error) {
+	// The application credential has to be created with a token scoped to
+	// the new project, which application credential auth can't obtain.
+	if is.cfg.UsesApplicationCredential() {
+		return logical.ErrorResponse("ephemeral projects require username/password authentication"), nil
+	}
+
+	userID, err := b.userID(is.cfg, is.identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	roleIDs, err := resolveRoleIDs(ctx, is.identityClient, is.role.Roles)
+	if err != nil {
+		return nil, err
+	}
+	if len(roleIDs) == 0 {
+		return logical.ErrorResponse("ephemeral_project rolesets need roles to grant the configured user on the project"), nil
+	}
+
+	name := fmt.Sprintf("vault-%s-%s-%d", is.name, req.DisplayName, time.Now().UnixMilli())
+	expireTime := time.Now().Add(is.maxTTL)
+	description, err := b.issuedCredentialDescription(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	walID, err := framework.PutWAL(ctx, req.Storage, walTypeEphemeralProject, &walEphemeralProject{
+		RoleSet:  is.name,
+		Cloud:    is.role.Cloud,
+		DomainID: is.role.ProjectDomainID,
+		UserID:   userID,
+		Name:     name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	project, err := projects.Create(ctx, is.identityClient, projects.CreateOpts{
+		Name:        name,
+		DomainID:    is.role.ProjectDomainID,
+		ParentID:    is.role.ParentProjectID,
+		Description: description,
+	}).Extract()
+	if err != nil {
+		b.Logger().Warn("Create project", "error", err)
+		return nil, err
+	}
+
+	// Leave the WAL entry behind if the project can't be removed right away
+	// so that the rollback retries.
+	abort := func(err error) (*logical.Response, error) {
+		if delErr := projects.Delete(ctx, is.identityClient, project.ID).ExtractErr(); delErr == nil {
+			if walErr := framework.DeleteWAL(ctx, req.Storage, walID); walErr != nil {
+				b.Logger().Warn("failed to delete WAL entry", "error", walErr)
+			}
+		}
+		return nil, err
+	}
+
+	for _, roleID := range roleIDs {
+		if err := roles.Assign(ctx, is.identityClient, roleID, roles.AssignOpts{
+			UserID:    userID,
+			ProjectID: project.ID,
+		}).ExtractErr(); err != nil {
+			return abort(fmt.Errorf("error assigning role %q: %w", roleID, err))
+		}
+	}
+
+	if err := applyProjectQuotas(ctx, is.identityClient.ProviderClient, is.cfg.RegionName, project.ID, is.role.Quotas); err != nil {
+		return abort(err)
+	}
+
+	projectClient, err := client(ctx, is.cfg, &RoleSet{ProjectID: project.ID})
+	if err != nil {
+		return abort(fmt.Errorf("error creating identity client for project: %w", err))
+	}
+
+	credential, err := applicationcredentials.Create(ctx, projectClient, userID, applicationcredentials.CreateOpts{
+		Name:        name,
+		Description: description,
+		Roles:       is.role.Roles,
+		AccessRules: is.role.AccessRules,
+		ExpiresAt:   &expireTime,
+	}).Extract()
+	if err != nil {
+		return abort(fmt.Errorf("error creating application credential: %w", err))
+	}
+
+	resp := b.Secret(SecretEphemeralProjectType).Response(map[string]interface{}{
+		"project_id":                    project.ID,
+		"project_name":                  project.Name,
+		"application_credential_id":     credential.ID,
+		"application_credential_secret": credential.Secret,
+	}, map[string]interface{}{
+		"project_id":                project.ID,
+		"application_credential_id": credential.ID,
+		"user_id":                   userID,
+		"roleset":                   is.name,
+		"cloud":                     is.role.Cloud,
+		"expires_at":                expireTime.Format(time.RFC3339),
+	})
+	resp.Secret.TTL = is.ttl
+	resp.Secret.MaxTTL = is.maxTTL
+
+	if err := b.putIssuedCredential(ctx, req.Storage, credential.ID, &issuedCredential{
+		RoleSet:   is.name,
+		Cloud:     is.role.Cloud,
+		ExpiresAt: expireTime,
+	}); err != nil {
+		return nil, fmt.Errorf("error storing issued credential: %w", err)
+	}
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+// applyProjectQuotas sets the configured quotas on a project, looking up
+// each service in the catalog of the provider client.
+func applyProjectQuotas(ctx context.Context, providerClient *gophercloud.ProviderClient, region, projectID string, quotas *projectQuotas) error {
+	if quotas == nil {
+		return nil
+	}
+	endpointOpts := gophercloud.EndpointOpts{Region: region}
+
+	if quotas.Compute != nil {
+		computeClient, err := openstack.NewComputeV2(providerClient, endpointOpts)
+		if err != nil {
+			return fmt.Errorf("error creating compute client: %w", err)
+		}
+		if _, err := computequotas.Update(ctx, computeClient, projectID, quotas.Compute).Extract(); err != nil {
+			return fmt.Errorf("error setting compute quotas: %w", err)
+		}
+	}
+
+	if quotas.Network != nil {
+		networkClient, err := openstack.NewNetworkV2(providerClient, endpointOpts)
+		if err != nil {
+			return fmt.Errorf("error creating network client: %w", err)
+		}
+		if _, err := networkquotas.Update(ctx, networkClient, projectID, quotas.Network).Extract(); err != nil {
+			return fmt.Errorf("error setting network quotas: %w", err)
+		}
+	}
+
+	if quotas.Volume != nil {
+		volumeClient, err := openstack.NewBlockStorageV3(providerClient, endpointOpts)
+		if err != nil {
+			return fmt.Errorf("error creating block storage client: %w", err)
+		}
+		if _, err := volumequotas.Update(ctx, volumeClient, projectID, quotas.Volume).Extract(); err != nil {
+			return fmt.Errorf("error setting volume quotas: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (b *backend) secretEphemeralProjectRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	projectID, err := leaseInternalString(req, "project_id")
+	if err != nil {
+		return nil, err
+	}
+	credentialID, err := leaseInternalString(req, "application_credential_id")
+	if err != nil {
+		return nil, err
+	}
+	userID, err := leaseInternalString(req, "user_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applicationcredentials.Delete(ctx, identityClient, userID, credentialID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+	if err := req.Storage.Delete(ctx, issuedCredentialPrefix+credentialID); err != nil {
+		return nil, err
+	}
+
+	if err := projects.Delete(ctx, identityClient, projectID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,47 @@
+package openstack
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/tokens"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretKeystoneTokenType = "keystone_token"
+)
+
+func secretKeystoneToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretKeystoneTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"token": {
+				Type:        framework.TypeString,
+				Description: "Keystone token (X-Subject-Token)",
+			},
+		},
+		Revoke: b.releasingLease(b.secretKeystoneTokenRevoke),
+	}
+}
+
+func (b *backend) secretKeystoneTokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := leaseInternalString(req, "token")
+	if err != nil {
+		return nil, err
+	}
+
+	// Expired tokens are already gone from Keystone's point of view.
+	if err := tokens.Revoke(ctx, identityClient, token).Err; err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,121 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretLibraryType = "library_credential"
+)
+
+func secretLibrary(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretLibraryType,
+		Fields: map[string]*framework.FieldSchema{
+			"account": {
+				Type:        framework.TypeString,
+				Description: "Name of the checked out account",
+			},
+		},
+		Renew:  b.secretLibraryRenew,
+		Revoke: b.secretLibraryRevoke,
+	}
+}
+
+func (b *backend) secretLibraryRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setName, err := leaseInternalString(req, "set")
+	if err != nil {
+		return nil, err
+	}
+
+	rawExpiresAt, err := leaseInternalString(req, "expires_at")
+	if err != nil {
+		return nil, err
+	}
+	expiresAt, err := time.Parse(time.RFC3339, rawExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse expires_at: %w", err)
+	}
+
+	set, err := b.librarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, fmt.Errorf("library set %q not found", setName)
+	}
+
+	leaseConfig, err := b.LeaseConfig(ctx, req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
+	}
+
+	ttl, _ := b.leaseTTLs(&RoleSet{TTL: set.TTL, MaxTTL: set.MaxTTL}, leaseConfig)
+
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = expiresAt.Sub(req.Secret.IssueTime)
+
+	return resp, nil
+}
+
+// secretLibraryRevoke checks the account back in when its lease ends, unless
+// it was already checked in and possibly checked out again since.
+func (b *backend) secretLibraryRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	setName, err := leaseInternalString(req, "set")
+	if err != nil {
+		return nil, err
+	}
+	accountName, err := leaseInternalString(req, "account")
+	if err != nil {
+		return nil, err
+	}
+	checkOutID, err := leaseInternalString(req, "check_out_id")
+	if err != nil {
+		return nil, err
+	}
+
+	b.libraryLock.Lock()
+	defer b.libraryLock.Unlock()
+
+	set, err := b.librarySet(ctx, req.Storage, setName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		// Sets can't be deleted while accounts are checked out, so there is
+		// nothing left to check in.
+		return nil, nil
+	}
+
+	account, err := b.libraryAccount(ctx, req.Storage, setName, accountName)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.CheckOut == nil || account.CheckOut.ID != checkOutID {
+		return nil, nil
+	}
+
+	is, resp, err := b.libraryIssuance(ctx, req.Storage, set)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil {
+		return nil, resp.Error()
+	}
+
+	account.CheckOut = nil
+	if err := b.rotateLibraryAccount(ctx, req.Storage, is, setName, accountName, account); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
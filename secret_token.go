@@ -4,7 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
+	"github.com/gophercloud/gophercloud/v2"
 	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/applicationcredentials"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -23,22 +26,28 @@ func secretToken(b *backend) *framework.Secret {
 				Description: "Application credential token",
 			},
 		},
-		Revoke: b.secretTokenRevoke,
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretTokenRevoke),
 	}
 }
 
-func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	// Get the roleset name from the lease
-	rolesetRaw, ok := req.Secret.InternalData["roleset"]
-	if !ok {
-		return nil, errors.New("roleset is missing on the lease")
+func (b *backend) secretTokenRenew(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	rolesetName, err := leaseInternalString(req, "roleset")
+	if err != nil {
+		return nil, err
 	}
-	rolesetName, ok := rolesetRaw.(string)
-	if !ok {
-		return nil, errors.New("unable to convert roleset name")
+
+	// The application credential expiry in Keystone is fixed at creation, so
+	// the lease can never be extended past it.
+	rawExpiresAt, err := leaseInternalString(req, "expires_at")
+	if err != nil {
+		return nil, errors.New("lease was issued without an expiry and is not renewable")
+	}
+	expiresAt, err := time.Parse(time.RFC3339, rawExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse expires_at: %w", err)
 	}
 
-	// Load the roleset
 	role, err := b.Role(ctx, req.Storage, rolesetName)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving roleset: %w", err)
@@ -47,31 +56,116 @@ func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d
 		return nil, fmt.Errorf("roleset %q not found", rolesetName)
 	}
 
-	cfg, err := b.readConfigAccess(ctx, req.Storage)
+	leaseConfig, err := b.LeaseConfig(ctx, req.Storage)
 	if err != nil {
-		return nil, fmt.Errorf("error reading access config: %w", err)
+		return nil, err
 	}
-	if cfg == nil {
-		return nil, errors.New("access config not found")
+	if leaseConfig == nil {
+		leaseConfig = &configLease{}
 	}
 
-	identityClient, err := client(ctx, cfg, role)
+	ttl, _ := b.leaseTTLs(role, leaseConfig)
+
+	resp := &logical.Response{Secret: req.Secret}
+	resp.Secret.TTL = ttl
+	resp.Secret.MaxTTL = expiresAt.Sub(req.Secret.IssueTime)
+
+	return resp, nil
+}
+
+func (b *backend) secretTokenRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, cfg, err := b.leaseClient(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("error creating identity client: %w", err)
+		return nil, err
 	}
 
-	IDRaw, ok := req.Secret.InternalData["application_credential_id"]
-	if !ok {
-		return nil, fmt.Errorf("application_credential_id is missing on the lease")
+	id, err := leaseInternalString(req, "application_credential_id")
+	if err != nil {
+		return nil, err
 	}
-	id, ok := IDRaw.(string)
-	if !ok {
-		return nil, errors.New("unable to convert application_credential_id")
+
+	// Leases issued before the user ID was recorded fall back to the user
+	// the config authenticates as.
+	userID, err := leaseInternalString(req, "user_id")
+	if err != nil {
+		if userID, err = b.userID(cfg, identityClient); err != nil {
+			return nil, err
+		}
+	}
+
+	// A credential that is already gone, e.g. removed by tidy, needs no
+	// further cleanup in Keystone.
+	if err := applicationcredentials.Delete(ctx, identityClient, userID, id).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
 	}
 
-	if err := applicationcredentials.Delete(ctx, identityClient, cfg.UserID, id).ExtractErr(); err != nil {
+	if err := req.Storage.Delete(ctx, issuedCredentialPrefix+id); err != nil {
 		return nil, err
 	}
 
 	return nil, nil
 }
+
+// leaseTTLs returns the lease TTL and max TTL for credentials issued from the
+// roleset. Roleset values take precedence over config/lease, which in turn
+// takes precedence over the mount defaults.
+func (b *backend) leaseTTLs(role *RoleSet, leaseConfig *configLease) (time.Duration, time.Duration) {
+	ttl := leaseConfig.TTL
+	if role.TTL > 0 {
+		ttl = role.TTL
+	}
+	if ttl <= 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+
+	maxTTL := leaseConfig.MaxTTL
+	if role.MaxTTL > 0 {
+		maxTTL = role.MaxTTL
+	}
+	if maxTTL <= 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+
+	if ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	return ttl, maxTTL
+}
+
+// leaseClient returns an identity client for the cloud the lease was issued
+// from, which may differ from the roleset's current cloud or outlive the
+// roleset.
+func (b *backend) leaseClient(ctx context.Context, req *logical.Request) (*gophercloud.ServiceClient, *Config, error) {
+	rolesetName, err := leaseInternalString(req, "roleset")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Leases issued before the cloud was recorded use the roleset's.
+	var cloud *string
+	if recorded, err := leaseInternalString(req, "cloud"); err == nil {
+		cloud = &recorded
+	}
+
+	identityClient, cfg, err := b.issuedClient(ctx, req.Storage, rolesetName, cloud)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg == nil {
+		return nil, nil, errors.New("access config not found")
+	}
+	return identityClient, cfg, nil
+}
+
+func leaseInternalString(req *logical.Request, key string) (string, error) {
+	raw, ok := req.Secret.InternalData[key]
+	if !ok {
+		return "", fmt.Errorf("%s is missing on the lease", key)
+	}
+	value, ok := raw.(string)
+	if !ok {
+		return "", fmt.Errorf("unable to convert %s", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,203 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestBackend_LeaseTTLs(t *testing.T) {
+	t.Parallel()
+
+	b, _ := getTestBackend(t)
+
+	tests := []struct {
+		name           string
+		role           RoleSet
+		lease          configLease
+		expectedTTL    time.Duration
+		expectedMaxTTL time.Duration
+	}{
+		{
+			name:           "mount defaults",
+			expectedTTL:    defaultLeaseTTLHr * time.Hour,
+			expectedMaxTTL: maxLeaseTTLHr * time.Hour,
+		},
+		{
+			name:           "lease config",
+			lease:          configLease{TTL: time.Minute, MaxTTL: time.Hour},
+			expectedTTL:    time.Minute,
+			expectedMaxTTL: time.Hour,
+		},
+		{
+			name:           "roleset overrides lease config",
+			role:           RoleSet{TTL: 5 * time.Minute, MaxTTL: 2 * time.Hour},
+			lease:          configLease{TTL: time.Minute, MaxTTL: time.Hour},
+			expectedTTL:    5 * time.Minute,
+			expectedMaxTTL: 2 * time.Hour,
+		},
+		{
+			name:           "ttl capped by max_ttl",
+			role:           RoleSet{MaxTTL: 30 * time.Minute},
+			lease:          configLease{TTL: time.Hour},
+			expectedTTL:    30 * time.Minute,
+			expectedMaxTTL: 30 * time.Minute,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, maxTTL := b.(*backend).leaseTTLs(&tc.role, &tc.lease)
+			if ttl != tc.expectedTTL {
+				t.Errorf("ttl = %v, expected %v", ttl, tc.expectedTTL)
+			}
+			if maxTTL != tc.expectedMaxTTL {
+				t.Errorf("max_ttl = %v, expected %v", maxTTL, tc.expectedMaxTTL)
+			}
+		})
+	}
+}
+
+func TestSecretToken_Renew(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.CreateOperation,
+		Path:      "roleset/test",
+		Data: map[string]interface{}{
+			"ttl":     "10m",
+			"max_ttl": "1h",
+		},
+		Storage: reqStorage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issueTime := time.Now()
+	resp, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   reqStorage,
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{IssueTime: issueTime},
+			InternalData: map[string]interface{}{
+				"secret_type":               SecretTokenType,
+				"application_credential_id": "appcred123",
+				"roleset":                   "test",
+				"expires_at":                issueTime.Add(time.Hour).Format(time.RFC3339),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || resp.Secret == nil {
+		t.Fatal("expected secret in response")
+	}
+	if resp.Secret.TTL != 10*time.Minute {
+		t.Errorf("ttl = %v, expected %v", resp.Secret.TTL, 10*time.Minute)
+	}
+	if resp.Secret.MaxTTL > time.Hour || resp.Secret.MaxTTL < time.Hour-time.Second {
+		t.Errorf("max_ttl = %v, expected about %v", resp.Secret.MaxTTL, time.Hour)
+	}
+}
+
+func TestSecretToken_RenewWithoutExpiry(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+
+	_, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   reqStorage,
+		Secret: &logical.Secret{
+			InternalData: map[string]interface{}{
+				"secret_type":               SecretTokenType,
+				"application_credential_id": "appcred123",
+				"roleset":                   "test",
+			},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected error renewing a lease without an expiry")
+	}
+}
+
+func TestSecretToken_RevokeUsesIssuingCloud(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	issuing := newTestKeystone(t)
+	other := newTestKeystone(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatal(resp.Error())
+		}
+		return resp
+	}
+	access := func(ks *testKeystone) map[string]interface{} {
+		return map[string]interface{}{
+			"auth_url":          ks.URL + "/v3",
+			"username":          "svc",
+			"user_domain_id":    "default",
+			"password":          "secret",
+			"verify_connection": false,
+		}
+	}
+
+	request(logical.UpdateOperation, configAccessKey, access(issuing))
+	request(logical.UpdateOperation, configCloudPrefix+"other", access(other))
+	request(logical.UpdateOperation, "roleset/member", map[string]interface{}{
+		"project_id":        "project123",
+		"roles":             "member",
+		"verify_connection": false,
+	})
+
+	first := request(logical.ReadOperation, "creds/member", nil)
+	second := request(logical.ReadOperation, "creds/member", nil)
+
+	// Moving the roleset doesn't move the leases it already issued
+	request(logical.UpdateOperation, "roleset/member", map[string]interface{}{
+		"cloud":             "other",
+		"verify_connection": false,
+	})
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   reqStorage,
+		Secret:    first.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nor does deleting it
+	request(logical.DeleteOperation, "roleset/member", nil)
+	if _, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   reqStorage,
+		Secret:    second.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := issuing.appCredDeletes.Load(); n != 2 {
+		t.Errorf("expected 2 deletes in the issuing cloud, got %d", n)
+	}
+	if n := other.appCredDeletes.Load(); n != 0 {
+		t.Errorf("expected no deletes in the other cloud, got %d", n)
+	}
+}
@@ -0,0 +1,129 @@
+package openstack
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gophercloud/gophercloud/v2"
+	"github.com/gophercloud/gophercloud/v2/openstack/identity/v3/trusts"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	SecretTrustType = "trust"
+)
+
+func secretTrust(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretTrustType,
+		Fields: map[string]*framework.FieldSchema{
+			"trust_id": {
+				Type:        framework.TypeString,
+				Description: "ID of the Keystone trust",
+			},
+		},
+		Renew:  b.secretTokenRenew,
+		Revoke: b.releasingLease(b.secretTrustRevoke),
+	}
+}
+
+func (b *backend) issueTrust(ctx context.Context, req *logical.Request, is *issuance) (*logical.Response, error) {
+	if is.trusteeUserID == "" {
+		return logical.ErrorResponse("trustee_user_id is required for rolesets issuing trusts"), nil
+	}
+	if !slices.Contains(is.role.AllowedTrusteeUserIDs, is.trusteeUserID) {
+		return logical.ErrorResponse(fmt.Sprintf("trustee_user_id %q is not in the roleset's allowed_trustee_user_ids", is.trusteeUserID)), nil
+	}
+
+	projectID, err := scopedProjectID(is.identityClient)
+	if err != nil {
+		return logical.ErrorResponse("trusts require a project-scoped roleset: %s", err), nil
+	}
+
+	trustorUserID, err := b.userID(is.cfg, is.identityClient)
+	if err != nil {
+		return nil, err
+	}
+
+	trustRoles := make([]trusts.Role, 0, len(is.role.Roles))
+	for _, role := range is.role.Roles {
+		trustRoles = append(trustRoles, trusts.Role{ID: role.ID, Name: role.Name})
+	}
+
+	// The Keystone expiry is set to the max TTL so the lease can be renewed up
+	// to that point; Vault revokes the trust earlier if it isn't renewed.
+	// Keystone keeps it to the millisecond, which is what identifies the
+	// trust to the rollback.
+	expireTime := time.Now().Add(is.maxTTL).Truncate(time.Millisecond)
+
+	// Trusts have no name to find them by, so the WAL entry records the
+	// trustor, trustee, project and expiry of the trust instead.
+	walID, err := framework.PutWAL(ctx, req.Storage, walTypeTrust, &walTrust{
+		RoleSet:       is.name,
+		Cloud:         is.role.Cloud,
+		TrustorUserID: trustorUserID,
+		TrusteeUserID: is.trusteeUserID,
+		ProjectID:     projectID,
+		ExpiresAt:     expireTime.Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %w", err)
+	}
+
+	trust, err := trusts.Create(ctx, is.identityClient, trusts.CreateOpts{
+		TrustorUserID: trustorUserID,
+		TrusteeUserID: is.trusteeUserID,
+		ProjectID:     projectID,
+		Roles:         trustRoles,
+		Impersonation: is.role.Impersonation,
+		ExpiresAt:     &expireTime,
+	}).Extract()
+	if err != nil {
+		b.Logger().Warn("Create trust", "error", err)
+		return nil, err
+	}
+
+	resp := b.Secret(SecretTrustType).Response(map[string]interface{}{
+		"trust_id":        trust.ID,
+		"trustor_user_id": trustorUserID,
+		"trustee_user_id": is.trusteeUserID,
+		"project_id":      projectID,
+		"impersonation":   is.role.Impersonation,
+		"expires_at":      expireTime.Format(time.RFC3339),
+	}, map[string]interface{}{
+		"trust_id":   trust.ID,
+		"roleset":    is.name,
+		"cloud":      is.role.Cloud,
+		"expires_at": expireTime.Format(time.RFC3339),
+	})
+	resp.Secret.TTL = is.ttl
+	resp.Secret.MaxTTL = is.maxTTL
+
+	if err := framework.DeleteWAL(ctx, req.Storage, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (b *backend) secretTrustRevoke(ctx context.Context, req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	identityClient, _, err := b.leaseClient(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	trustID, err := leaseInternalString(req, "trust_id")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := trusts.Delete(ctx, identityClient, trustID).ExtractErr(); err != nil && !gophercloud.ResponseCodeIs(err, http.StatusNotFound) {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,79 @@
+package openstack
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func TestTrust_AllowedTrustees(t *testing.T) {
+	t.Parallel()
+
+	b, reqStorage := getTestBackend(t)
+	ks := newTestKeystone(t)
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		t.Helper()
+		resp, err := b.HandleRequest(context.Background(), &logical.Request{
+			Operation: op,
+			Path:      path,
+			Data:      data,
+			Storage:   reqStorage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, configAccessKey, map[string]interface{}{
+		"auth_url":          ks.URL + "/v3",
+		"username":          "svc",
+		"user_domain_id":    "default",
+		"password":          "secret",
+		"verify_connection": false,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatal(resp.Error())
+	}
+
+	// Rolesets without an allowlist can't issue trusts at all
+	resp = request(logical.UpdateOperation, "roleset/orchestration", map[string]interface{}{
+		"credential_type":   credentialTypeTrust,
+		"project_id":        "project123",
+		"roles":             "member",
+		"verify_connection": false,
+	})
+	if resp == nil || resp.IsError() || len(resp.Warnings) != 1 {
+		t.Fatalf("expected a warning about the missing allowlist, got %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "creds/orchestration", map[string]interface{}{"trustee_user_id": "user456"})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected trustee to be refused, got %#v", resp)
+	}
+
+	resp = request(logical.UpdateOperation, "roleset/orchestration", map[string]interface{}{
+		"allowed_trustee_user_ids": "user456,user789",
+		"verify_connection":        false,
+	})
+	if resp != nil {
+		t.Fatalf("unexpected response: %#v", resp)
+	}
+
+	resp = request(logical.ReadOperation, "creds/orchestration", map[string]interface{}{"trustee_user_id": "attacker"})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected trustee to be refused, got %#v", resp)
+	}
+	if n := ks.trustCreates.Load(); n != 0 {
+		t.Fatalf("expected no trusts to be created, got %d", n)
+	}
+
+	resp = request(logical.ReadOperation, "creds/orchestration", map[string]interface{}{"trustee_user_id": "user789"})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("expected trust to be issued, got %#v", resp)
+	}
+	if trust, ok := ks.trusts.Load(resp.Data["trust_id"]); !ok || trust.(testTrust).TrusteeUserID != "user789" {
+		t.Errorf("expected a trust for user789, got %v", trust)
+	}
+}